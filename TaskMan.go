@@ -7,8 +7,15 @@ package main
 import (
 	"bufio"
 	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand/v2"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
 	"slices"
 	"strconv"
 	"strings"
@@ -24,6 +31,7 @@ const ( // ANSI color codes for terminal output
 	Magenta = "\033[35m"
 	Cyan    = "\033[36m"
 	White   = "\033[97m"
+	Dim     = "\033[2m"
 )
 
 type Task struct {
@@ -32,508 +40,4735 @@ type Task struct {
 	priority string
 	repeat   string
 	label    string
-	done     string
+	done     string // "Yes", "No", or "Doing" when in progress
 	notes    string
+
+	completed      time.Time // when the task was last marked done
+	repeatFromDone bool      // if true, recurrence advances from completed instead of due
+	subtasks       []Subtask // checklist of steps within the task
+	color          string    // color name to always show the task in, unless overdue
+	hiddenUntil    string    // title of a task that must be done before this one is listed
+	estimate       int       // expected minutes of work, 0 if not estimated
+	comments       []string  // "#" lines from the data file just above this task, saved back with it
+	created        time.Time // when the task was added, zero if before this was recorded
+	modified       time.Time // when the task was last changed, zero if never recorded
+	tentative      bool      // a someday/maybe task, shown dimmed and left out of due and overdue counts
+	badDue         string    // the due date as found in the file if it couldn't be read, kept until fixed
+	given          []string  // the fields an import file gave, by CSV column name, so merging changes only those
+}
+
+type Subtask struct {
+	text string
+	done bool
+}
+
+var colorNames = map[string]string{ // colors that can be chosen for a task
+	"red":     Red,
+	"green":   Green,
+	"yellow":  Yellow,
+	"blue":    Blue,
+	"magenta": Magenta,
+	"pink":    Magenta,
+	"cyan":    Cyan,
+	"white":   White,
 }
 
 var taskList []Task // global task list
 
+const maxTitleLength = 30 // longest title that can be entered; the list shows as much as fits
+
+var now = time.Now // clock used for all date calculations, replaceable for testing and planning
+
 type Config struct { // global configuration data
 	folderPath string // path to folder containing data file
 	filePath   string // full path to data file
 	extra2     string // reserved for future use
+
+	requireDueDate bool   // if true, new tasks must have a due date
+	maxTasks       int    // warn when adding more tasks than this, 0 = unlimited
+	dueSoonDays    int    // how many days ahead DueTasks looks
+	doneLast       bool   // if true, sorting keeps done tasks below not-done tasks
+	sortBy         string // last sort chosen: "name", "priority" or "due"
+	autoSort       bool   // if true, the list is re-sorted after every change
+	weekStart      string // first day of the week for grouping: "Monday" or "Sunday"
+	busyDay        int    // warn when this many not-done tasks are due on one day, 0 = never
+	confirmRepeat  bool   // if true, ask before marking a recurring task done
+	autoArchive    int    // archive tasks done more than this many days ago on startup, 0 = off
+	maxNoteLength  int    // warn about notes longer than this when loading; they are kept, never cut
+	locale         string // language for weekday and month names, a key of locales
+	overdueGrace   int    // days past due before a task counts as overdue, 0 = none
+	strictImport   bool   // if true, imported JSON records with bad values are rejected instead of repaired
+	explicitNoDue  bool   // if true, a new task needs "none" typed for no due date, rather than blank
+	header         string // title shown above the list
+	compactPrompt  bool   // if true, the main prompt is short instead of listing the options
+	notify         string // on startup, alert about tasks due today or overdue: "Off", "Bell" or "Desktop"
+	doneMarkers    string // how the Done column is shown, a key of doneMarkerStyles
 }
 
 var config Config
 
-// ReadConfig reads configuration from file, or creates default config if file not found
-func ReadConfig() {
-	path, _ := os.UserHomeDir() // should check for error, but no home folder? Unlikely
-	file, err := os.Open(path + "/TaskManGoConfig.txt")
-	if err != nil { // Create default config file
+const defaultHeader = "TaskManGo Task Manager:"
+
+// promptStyle returns how the main prompt is shown, "compact" or "verbose", as saved in the config file
+func promptStyle() string {
+	if config.compactPrompt {
+		return "compact"
+	}
+	return "verbose"
+}
+
+// MainPrompt returns the prompt for a command, listing the main options unless config.compactPrompt is set
+func MainPrompt() string {
+	if config.compactPrompt {
+		return "\nCommand (h for help)? "
+	}
+	return "\nOptions: (a)dd, (i)nbox, (e)dit, (d)one, (s)ort, (f)ilter, (r)emove, (h)elp, (q)uit? "
+}
+
+// configPath returns the path of the config file in the user's home directory
+func configPath() string {
+	home, _ := os.UserHomeDir() // should check for error, but no home folder? Unlikely
+	return filepath.Join(home, "TaskManGoConfig.txt")
+}
+
+// ReadConfig reads configuration from file, or creates default config if file not found,
+// returning true if it did
+func ReadConfig() bool {
+	if !LoadConfig() { // Create default config file
 		config.folderPath = GetFolderPath() // get folder to store data file
-		config.filePath = config.folderPath + "/TaskManGo.txt"
+		config.filePath = filepath.Join(config.folderPath, "TaskManGo.txt")
+		config.dueSoonDays = 3
+		config.sortBy = "due"
+		config.autoSort = true
+		config.weekStart = "Monday"
+		config.busyDay = 5
+		config.maxNoteLength = 500
+		config.locale = "en"
+		config.header = defaultHeader
+		config.notify = "Off"
+		config.doneMarkers = "words"
 		WriteConfig()
-		return
+		return true
+	}
+	return false
+}
+
+// LoadConfig reads configuration from file, asking nothing, and returns false if there isn't one
+func LoadConfig() bool {
+	file, err := os.Open(configPath())
+	if err != nil {
+		return false
 	}
 	defer file.Close()
 
 	scanner := bufio.NewScanner(file)
-	data := []string{"", "", ""}
+	data := make([]string, 22) // one line per setting, missing lines are left blank
 	for i := 0; scanner.Scan() && i < len(data); i++ {
 		data[i] = strings.TrimSpace(scanner.Text())
 	}
 	if err := scanner.Err(); err != nil {
 		panic(err)
 	}
-	config.folderPath = data[0]
+	config.folderPath = CleanFolderPath(data[0]) // older versions saved it as typed
 	config.filePath = data[1]
 	config.extra2 = data[2]
+	config.requireDueDate = data[3] == "Yes"
+	config.maxTasks, _ = strconv.Atoi(data[4]) // blank or invalid means unlimited
+	config.dueSoonDays, err = strconv.Atoi(data[5])
+	if err != nil || config.dueSoonDays < 0 {
+		config.dueSoonDays = 3
+	}
+	config.doneLast = data[6] == "Yes"
+	config.sortBy = data[7]
+	if config.sortBy == "" {
+		config.sortBy = "due"
+	}
+	config.autoSort = data[8] != "No" // on unless turned off
+	config.weekStart = "Monday"
+	if strings.EqualFold(data[9], "Sunday") {
+		config.weekStart = "Sunday"
+	}
+	config.busyDay, err = strconv.Atoi(data[10])
+	if err != nil || config.busyDay < 0 {
+		config.busyDay = 5
+	}
+	config.confirmRepeat = data[11] == "Yes"
+	config.autoArchive, _ = strconv.Atoi(data[12]) // blank or invalid means off
+	config.maxNoteLength, err = strconv.Atoi(data[13])
+	if err != nil || config.maxNoteLength < 1 {
+		config.maxNoteLength = 500
+	}
+	config.locale = strings.ToLower(data[14])
+	if _, ok := locales[config.locale]; !ok {
+		config.locale = "en"
+	}
+	config.overdueGrace, err = strconv.Atoi(data[15])
+	if err != nil || config.overdueGrace < 0 {
+		config.overdueGrace = 0
+	}
+	config.strictImport = data[16] == "Yes"
+	config.explicitNoDue = data[17] == "Yes"
+	config.header = data[18]
+	if config.header == "" {
+		config.header = defaultHeader
+	}
+	config.compactPrompt = strings.EqualFold(data[19], "compact")
+	config.notify = "Off"
+	for _, notify := range []string{"Bell", "Desktop"} {
+		if strings.EqualFold(data[20], notify) {
+			config.notify = notify
+		}
+	}
+	config.doneMarkers = strings.ToLower(data[21])
+	if _, ok := doneMarkerStyles[config.doneMarkers]; !ok {
+		config.doneMarkers = "words"
+	}
+	return true
 }
 
 // WriteConfig writes current configuration to file in user's home directory
 func WriteConfig() {
-	path, _ := os.UserHomeDir() // should check for error, but no home folder? Unlikely
-	file, err := os.Create(path + "/TaskManGoConfig.txt")
+	file, err := os.Create(configPath())
 	if err != nil {
 		fmt.Println("Error creating config file!")
 		return
 	}
 	defer file.Close()
 
+	lines := []string{
+		config.folderPath,
+		config.filePath,
+		config.extra2,
+		yesNo(config.requireDueDate),
+		strconv.Itoa(config.maxTasks),
+		strconv.Itoa(config.dueSoonDays),
+		yesNo(config.doneLast),
+		config.sortBy,
+		yesNo(config.autoSort),
+		config.weekStart,
+		strconv.Itoa(config.busyDay),
+		yesNo(config.confirmRepeat),
+		strconv.Itoa(config.autoArchive),
+		strconv.Itoa(config.maxNoteLength),
+		config.locale,
+		strconv.Itoa(config.overdueGrace),
+		yesNo(config.strictImport),
+		yesNo(config.explicitNoDue),
+		config.header,
+		promptStyle(),
+		config.notify,
+		config.doneMarkers,
+	}
 	writer := bufio.NewWriter(file)
-	_, err = writer.WriteString(config.folderPath + "\n")
-	if err != nil {
-		return
+	for _, line := range lines {
+		_, err = writer.WriteString(line + "\n")
+		if err != nil {
+			return
+		}
 	}
-	_, err = writer.WriteString(config.filePath + "\n")
-	if err != nil {
-		return
+	writer.Flush()
+}
+
+// OfferSampleTasks offers a new user some example tasks showing what TaskManGo can do,
+// unless they already have tasks. They're saved with the rest of the list.
+func OfferSampleTasks() {
+	if len(taskList) > 0 {
+		return // not a new user, just a new config
 	}
-	_, err = writer.WriteString(config.extra2 + "\n")
-	if err != nil {
+	if yesNoInput("Add some example tasks to get you started?") != "Yes" {
 		return
 	}
-	writer.Flush()
+	taskList = SampleTasks(now())
+}
+
+// SampleTasks returns example tasks using priorities, due dates and times, labels and repeats
+func SampleTasks(now time.Time) []Task {
+	today := startOfDay(now)
+	sample := func(title string, due time.Time, priority string, repeat string, label string, notes string) Task {
+		return Task{title: title, due: due, priority: priority, repeat: repeat, label: label, done: "No",
+			notes: notes, created: now, modified: now}
+	}
+	return []Task{
+		sample("Try adding a task", today, "1", "", "tutorial", "Press a at the prompt, then d to mark this done"),
+		sample("Call the dentist", today.AddDate(0, 0, 1).Add(10*time.Hour), "2", "", "home", "Due dates can have a time"),
+		sample("Weekly review", weekStart(now).AddDate(0, 0, 7), "2", "Weekly", "tutorial,work",
+			"Repeats every week; done tasks come back on their next date"),
+		sample("Read the help", noDueDate, "3", "", "tutorial", "Press h at the prompt to see every command"),
+	}
 }
 
 // GetFolderPath prompts user for folder path to store data file when config file not found
 func GetFolderPath() string {
 	fmt.Println("\nWhere do you want to store your data file?")
 	fmt.Println("Eg. /Users/name/Documents or C:\\Users\\name\\Documents")
-	path := inputStr("Enter path: ", 150)
+	path := CleanFolderPath(inputStr("Enter path: ", 150))
 
 	// check the path is valid folder
 	info, err := os.Stat(path)
-	if err != nil {
-		path, _ := os.UserHomeDir() // should check for error, but no home folder? Unlikely
-		fmt.Println("Invalid path! Using home directory:", path)
-	} else if !info.IsDir() {
-		path, _ := os.UserHomeDir() // should check for error...
+	if err != nil || !info.IsDir() {
+		path, _ = os.UserHomeDir() // should check for error, but no home folder? Unlikely
 		fmt.Println("Invalid path! Using home directory:", path)
 	}
 	return path
 }
 
+// CleanFolderPath tidies a typed folder path for this OS, making separators native and removing
+// trailing ones, so joining file names to it can't give mixed or doubled separators
+func CleanFolderPath(path string) string {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return ""
+	}
+	return filepath.Clean(path) // also turns / into \ on Windows
+}
+
 // ReadTasksFile reads tasks from data file into taskList
 func ReadTasksFile() {
-	data, err := os.Open(config.filePath)
+	tasks, err := LoadTasks(config.filePath)
 	if err != nil {
 		fmt.Println("\nError opening '", config.filePath)
 		fmt.Println()
 		return
 	}
-	defer data.Close()
+	taskList = tasks
+}
 
-	taskList = nil // reset taskList
-	scanner := bufio.NewScanner(data)
-	for scanner.Scan() {
-		str := strings.TrimSpace(scanner.Text())
-		str = str[1 : len(str)-1] // Remove the leading and trailing quotes
-		result := strings.Split(str, "\",\"")
-		dueDate, _ := time.Parse("2006-01-02", result[1])
-		taskList = append(taskList, Task{
-			title:    result[0],
-			due:      dueDate,
-			priority: result[2],
-			repeat:   result[3],
-			label:    result[4],
-			done:     result[5],
-			notes:    result[6],
-		})
+// WriteTasksFile writes tasks from taskList to data file, returning an error if they weren't saved.
+// Lines in the file that couldn't be loaded are backed up first, rather than dropped.
+// It asks nothing, so interactive callers offer SaveElsewhere themselves.
+func WriteTasksFile() error {
+	path := filepath.Join(config.folderPath, "TaskManGo.txt")
+	backedUp, err := BackupDroppedLines(path)
+	if err != nil {
+		fmt.Println("Error backing up data file!") // don't save over lines that would be lost
+		return err
 	}
-	if err := scanner.Err(); err != nil {
-		panic(err)
+	if backedUp {
+		fmt.Println("Lines that couldn't be read are kept in:", path+".bak")
+	}
+	if err := SaveTasks(path, taskList); err != nil {
+		fmt.Println("Error writing to file!")
+		return err
+	}
+	if err := SaveSnapshot(snapshotPath(), taskList, now()); err != nil {
+		fmt.Println("Error writing snapshot file!") // the tasks themselves were saved
 	}
+	fmt.Println("Tasks saved to:", config.filePath)
+	return nil
 }
 
-// WriteTasksFile writes tasks from taskList to data file
-func WriteTasksFile() {
-	data, err := os.Create(config.folderPath + "/TaskManGo.txt")
-	if err != nil {
-		fmt.Println("Error creating file!")
+// SaveAs writes taskList to another data file, eg. to share it, leaving the config unchanged
+func SaveAs() {
+	path := inputStr("Save a copy of the list to file: ", 150)
+	if path == "" {
 		return
 	}
-	defer data.Close()
-
-	writer := bufio.NewWriter(data)
-	for _, task := range taskList {
-		line := fmt.Sprintf("\"%s\",\"%s\",\"%s\",\"%s\",\"%s\",\"%s\",\"%s\"\n",
-			task.title, task.due.Format("2006-01-02"), task.priority, task.repeat, task.label, task.done, task.notes)
-		_, err := writer.WriteString(line)
-		if err != nil {
-			fmt.Println("Error writing to file!")
-			return
-		}
+	if err := SaveCopy(path, taskList); err != nil {
+		fmt.Println("Error:", err)
+	} else {
+		fmt.Println("Tasks saved to:", path)
 	}
-	writer.Flush()
-	fmt.Println("Tasks saved to:", config.filePath)
+	pause()
 }
 
-// Input helper functions
-func inputStr(prompt string, length int) string { // input a string, limit length
-	fmt.Print(prompt)
-	scanner := bufio.NewScanner(os.Stdin)
-	scanner.Scan()
-	text := strings.TrimSpace(scanner.Text())
-	if len(text) > length {
-		return text[:length]
+// SaveCopy saves tasks to path in the data file format, checking its folder exists first
+func SaveCopy(path string, tasks []Task) error {
+	info, err := os.Stat(filepath.Dir(path))
+	if err != nil || !info.IsDir() {
+		return fmt.Errorf("folder %s doesn't exist", filepath.Dir(path))
 	}
-	return text
+	return SaveTasks(path, tasks)
 }
 
-func yesNoInput(prompt string) string { // input yes/no, return "Yes" or "No"
-	response := strings.ToLower(inputStr(prompt+" (y/n): ", 5))
-	if response == "y" || response == "yes" {
-		return "Yes"
-	} else {
-		return "No"
+// CheckWritable warns up front if the data file can't be saved, so changes aren't lost unnoticed
+func CheckWritable() {
+	if Writable(config.filePath) {
+		return
 	}
+	fmt.Printf("%sWarning: %s is read-only, so changes can't be saved there.%s\n", Yellow, config.filePath, Reset)
+	fmt.Println("You'll be offered somewhere else to save when you quit.")
+	pause()
 }
 
-func inputInt(prompt string, min int, max int) int { // input an integer within a range
-	idx, err := strconv.Atoi(inputStr(prompt, 4))
-	if err != nil || idx < min || idx > max {
-		fmt.Printf("Number out of range (%d to %d).", min, max)
-		return -9999 // negative indicates invalid input
+// Writable reports whether path can be written, or created if it doesn't exist yet
+func Writable(path string) bool {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0) // opening doesn't change the file
+	if os.IsNotExist(err) {
+		file, err = os.CreateTemp(filepath.Dir(path), ".TaskManGo-*")
+		if err == nil {
+			defer os.Remove(file.Name())
+		}
 	}
-	return idx
+	if err != nil {
+		return false
+	}
+	file.Close()
+	return true
 }
 
-// add a new Task to taskList
-func addTask() {
-	fmt.Println("\n----- Add new task -----")
+// fallbackPath returns where tasks are saved when the data file can't be written
+func fallbackPath() string {
+	home, _ := os.UserHomeDir() // should check for error, but no home folder? Unlikely
+	return filepath.Join(home, "TaskManGo-unsaved.txt")
+}
 
-	title := inputStr("Task title: ", 20)
-	if title == "" {
-		fmt.Println("Task title cannot be empty!")
+// SaveElsewhere offers to save the tasks to the home folder after saving the data file failed
+func SaveElsewhere() {
+	path := fallbackPath()
+	if yesNoInput("Save your tasks to "+path+" instead?") != "Yes" {
 		return
 	}
+	if err := SaveTasks(path, taskList); err != nil {
+		fmt.Println("Error writing to file!")
+		return
+	}
+	fmt.Println("Tasks saved to:", path)
+	fmt.Println("Copy it over", config.filePath, "when that can be written again.")
+}
+
+const fileHeader = "#TaskManGo v2" // first line of the data file, marking the format version
 
-	dueDate := inputStr("Due date (YYYY-MM-DD): ", 12)
-	due, err := time.Parse("2006-01-02", dueDate)
+// LoadTasks reads all the tasks from a data file. Files starting with fileHeader
+// are v2 (CSV with escaping); files without a header are v1 (quoted fields, no escaping).
+func LoadTasks(path string) ([]Task, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		due, _ = time.Parse("2006-01-02", "2099-12-31")
+		return nil, err
 	}
-	due = time.Date(due.Year(), due.Month(), due.Day(), 0, 0, 0, 0, due.Location()) // set time to 00:00
-
-	priority := inputStr("Priority (1, 2, 3): ", 3)
-	if priority != "1" && priority != "2" {
-		priority = "3" // default priority
+	content := string(data)
+	if rest, ok := strings.CutPrefix(content, fileHeader); ok {
+		return parseTasksV2(rest)
 	}
+	return parseTasksV1(content)
+}
 
-	repeat := strings.ToLower(inputStr("Repeat (d)aily, (w)eekly, (m)onthly: ", 10))
-	switch repeat {
-	case "d", "daily":
-		repeat = "Daily"
-	case "w", "weekly":
-		repeat = "Weekly"
-	case "m", "monthly":
-		repeat = "Monthly"
-	default:
-		repeat = ""
+// parseTasksV1 parses the original data format, one task per line, skipping malformed lines
+func parseTasksV1(content string) ([]Task, error) {
+	var tasks []Task
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue // blank lines and comments aren't tasks
+		}
+		if task, ok := parseTaskLine(line); ok {
+			tasks = append(tasks, task)
+		} // skip malformed lines rather than crash
 	}
-
-	label := inputStr("Label/category: ", 12)
-	done := yesNoInput("Is the task done? ")
-	notes := inputStr("Additional notes: ", 100)
-
-	// Add the new task to the task list
-	taskList = append(taskList, Task{
-		title:    title,
-		due:      due,
-		priority: priority,
-		repeat:   repeat,
-		label:    label,
-		done:     done,
-		notes:    notes,
-	})
+	return tasks, scanner.Err()
 }
 
-// EditTask edits an existing task in taskList
-func EditTask() {
-	if len(taskList) == 0 {
-		fmt.Println("No tasks to edit!")
-		return
+// parseTasksV2 parses CSV task records, skipping malformed records and blank lines.
+// Lines starting with "#" are comments, kept with the task below them so they are saved
+// again; comments after the last task are kept with that task.
+func parseTasksV2(content string) ([]Task, error) {
+	var tasks []Task
+	var comments []string // comments waiting for the next task
+	record, quotes := "", 0
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if record == "" { // between records, not inside a quoted field
+			trimmed := strings.TrimSpace(line)
+			if trimmed == "" {
+				continue
+			}
+			if strings.HasPrefix(trimmed, "#") {
+				comments = append(comments, trimmed)
+				continue
+			}
+		}
+		record += line + "\n"
+		quotes += strings.Count(line, `"`)
+		if quotes%2 == 1 {
+			continue // a quoted field carries on to the next line
+		}
+		reader := csv.NewReader(strings.NewReader(record))
+		reader.FieldsPerRecord = -1 // allow extra or missing optional columns
+		fields, err := reader.Read()
+		record, quotes = "", 0
+		if err != nil {
+			continue // skip malformed records rather than crash
+		}
+		if task, ok := parseTaskFields(fields); ok {
+			task.comments, comments = comments, nil
+			tasks = append(tasks, task)
+		}
 	}
-	id := inputInt("Enter task ID to edit: ", 0, len(taskList)-1)
-	if id < 0 {
-		fmt.Println("Invalid task ID!")
-		return
+	if len(comments) > 0 && len(tasks) > 0 {
+		last := &tasks[len(tasks)-1]
+		last.comments = append(last.comments, comments...)
 	}
+	return tasks, scanner.Err()
+}
 
-	task := &taskList[id] // get pointer to the task to edit
-	fmt.Println("\n----- Edit task -----")
-	fmt.Println("1 Title:", task.title)
-	due := task.due.Format("2006-01-02")
-	if task.due.Equal(time.Date(2099, 12, 31, 0, 0, 0, 0, task.due.Location())) {
-		due = ""
+// SaveTasks writes tasks to a data file in the current (v2) format, replacing its contents.
+// Every field is CSV-escaped, so commas and quotes in titles or notes can't break the columns.
+func SaveTasks(path string, tasks []Task) error {
+	data, err := os.Create(path)
+	if err != nil {
+		return err
 	}
-	fmt.Println("2 Due date:", due)
-	fmt.Println("3 Priority:", task.priority)
-	fmt.Println("4 Repeat:", task.repeat)
-	fmt.Println("5 Label:", task.label)
-	fmt.Println("6 Done:", task.done)
-	fmt.Println("7 Notes:", task.notes)
-	choice := inputInt("\nNumber of field to edit (Enter cancels): ", 0, 7)
+	defer data.Close()
 
-	switch choice {
-	case 1:
-		newTitle := inputStr("New title: ", 30)
-		if newTitle != "" {
-			task.title = newTitle
-		}
-	case 2:
-		dueDate := inputStr("Due date (YYYY-MM-DD): ", 12)
-		due, err := time.Parse("2006-01-02", dueDate)
-		if err != nil {
-			due, _ = time.Parse("2006-01-02", "2099-12-31")
+	if _, err := data.WriteString(fileHeader + "\n"); err != nil {
+		return err
+	}
+	writer := csv.NewWriter(data)
+	for _, task := range tasks {
+		for _, comment := range task.comments {
+			writer.Flush()
+			if _, err := data.WriteString(comment + "\n"); err != nil {
+				return err
+			}
 		}
-		task.due = time.Date(due.Year(), due.Month(), due.Day(), 0, 0, 0, 0, due.Location()) // set time to 00:00
-	case 3:
-		priority := inputStr("New priority (1, 2, 3): ", 3)
-		if priority != "1" && priority != "2" {
-			priority = "3" // default priority
+		fields := taskFields(task)
+		if strings.HasPrefix(task.title, "#") { // quote it, or it would be read back as a comment
+			writer.Flush()
+			if _, err := data.WriteString(`"` + strings.ReplaceAll(task.title, `"`, `""`) + `",`); err != nil {
+				return err
+			}
+			fields = fields[1:]
 		}
-		task.priority = priority
-	case 4:
-		repeat := strings.ToLower(inputStr("New (d)aily, (w)eekly, (m)onthly: ", 10))
-		switch repeat {
-		case "d", "daily":
-			task.repeat = "Daily"
-		case "w", "weekly":
-			task.repeat = "Weekly"
-		case "m", "monthly":
-			task.repeat = "Monthly"
-		default:
-			task.repeat = ""
+		if err := writer.Write(fields); err != nil {
+			return err
 		}
-	case 5:
-		task.label = inputStr("New label: ", 12)
-	case 6:
-		task.done = yesNoInput("Is the task done? ")
-	case 7:
-		task.notes = inputStr("Additional notes: ", 100)
 	}
+	writer.Flush()
+	return writer.Error()
 }
 
-// ListTasks lists all tasks, optionally filtered by label
-func ListTasks(filterBy string) {
-	if len(taskList) == 0 {
-		fmt.Println("No tasks found. Create one now!")
-		return
+// CountTaskLines returns the number of task lines in a data file, not counting the version header,
+// comments or blank lines. A quoted field running over several lines counts once.
+func CountTaskLines(path string) (int, error) {
+	data, err := os.Open(path)
+	if err != nil {
+		return 0, err
 	}
-	fmt.Print("\033[H\033[2J") // clear the terminal screen
-	PrintTitleHeader()
-	for i, task := range taskList {
-		if filterBy != "" && task.label != filterBy {
-			continue
+	defer data.Close()
+
+	count, quotes := 0, 0
+	scanner := bufio.NewScanner(data)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if quotes%2 == 0 { // not inside a quoted field
+			if line == "" || strings.HasPrefix(line, "#") { // the version header is a comment too
+				continue
+			}
+			count++
 		}
-		PrintTask(i, task)
+		quotes += strings.Count(line, `"`)
 	}
+	return count, scanner.Err()
 }
 
-// PrintTitleHeader prints the header for the task list
-func PrintTitleHeader() {
-	fmt.Printf("\n%-3s", "ID")
-	fmt.Printf("%-20s", "Title")
-	fmt.Printf("%-12s", "Due")
-	fmt.Printf("%-6s", "Prty")
-	fmt.Printf("%-9s", "Repeat")
-	fmt.Printf("%-12s", "Label")
-	fmt.Printf("%-4s", "Done")
-	fmt.Println()
-	for range 70 {
-		fmt.Print("-")
+// LongNotes returns the indexes of tasks whose notes are longer than max characters
+func LongNotes(tasks []Task, max int) []int {
+	var long []int
+	for i, task := range tasks {
+		if len([]rune(task.notes)) > max {
+			long = append(long, i)
+		}
 	}
-	fmt.Println()
+	return long
 }
 
-// PrintTask prints a single task with color coding
-func PrintTask(i int, task Task) {
-	today := time.Now()
-	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, today.Location()) // set time to 00:00
-
-	if task.done == "Yes" {
-		fmt.Print(Green) // highlight done tasks in green
-	} else {
-		if task.due.Before(today) {
-			fmt.Print(Red) // highlight due/overdue tasks in red
-		} else if task.due.Equal(today) {
-			fmt.Print(Blue) // highlight tasks due today in yellow
-		}
+// CheckNotes warns about notes longer than config.maxNoteLength. They are kept in
+// full and saved unchanged, since cutting them would silently lose data.
+func CheckNotes() {
+	long := LongNotes(taskList, config.maxNoteLength)
+	if len(long) == 0 {
+		return
 	}
-
-	fmt.Printf("%-03d", i)
-	fmt.Printf("%-20s", task.title)
-	due := task.due.Format("2006-01-02")
-	if due == "2099-12-31" {
-		due = ""
+	fmt.Printf("%sWarning: %d tasks have notes longer than %d characters (kept in full):%s\n",
+		Yellow, len(long), config.maxNoteLength, Reset)
+	for _, i := range long {
+		fmt.Println("  " + taskList[i].title)
 	}
-	fmt.Printf("%-12s", due)
-	fmt.Printf(" %-5s", task.priority)
-	fmt.Printf("%-10s", task.repeat)
-	fmt.Printf("%-11s", task.label)
-	fmt.Printf("%-5s", task.done)
-	fmt.Println(Reset) // reset color
+	pause()
 }
 
-// RemoveTask removes a task from taskList by ID
-func RemoveTask() string {
-	if len(taskList) == 0 {
-		return "No tasks to delete!"
+// CheckTasksFile warns if some lines of the data file couldn't be loaded, and
+// offers to replace it with a cleaned version, keeping the original as a .bak file
+func CheckTasksFile() {
+	lines, err := CountTaskLines(config.filePath)
+	if err != nil || lines == len(taskList) {
+		return
 	}
-	id := inputInt("Enter task ID to delete: ", 0, len(taskList)-1)
-	if id < 0 {
-		return "Invalid task ID!"
+	fmt.Printf("%sWarning: %s has %d lines but only %d tasks could be loaded.%s\n",
+		Yellow, config.filePath, lines, len(taskList), Reset)
+	if yesNoInput("Write a cleaned version without the bad lines?") != "Yes" {
+		fmt.Println("The original will be kept as", config.filePath+".bak", "when the list is next saved.")
+		return
 	}
-	if len(taskList) == 1 {
-		taskList = nil
-	} else {
-		taskList = append(taskList[:id], taskList[id+1:]...)
+	if _, err := BackupDroppedLines(config.filePath); err != nil {
+		fmt.Println("Error backing up data file!")
+		return
 	}
-	return "Task deleted."
-}
-
-// DueTasks lists tasks that are due soon
-func DueTasks() { // tasks due soon
-	if len(taskList) == 0 {
+	if err := SaveTasks(config.filePath, taskList); err != nil {
+		fmt.Println("Error writing to file!")
 		return
 	}
-	today := time.Now()
-	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, today.Location()) // set time to 00:00
-	nextWeek := today.AddDate(0, 0, 3)                                                        // 3 days ahead
-	nextWeek = time.Date(nextWeek.Year(), nextWeek.Month(), nextWeek.Day(), 0, 0, 0, 0, nextWeek.Location())
+	fmt.Println("Original file kept as:", config.filePath+".bak")
+}
 
-	flag := true // to print header only once
-	for _, task := range taskList {
-		if task.done == "Yes" {
-			continue
-		}
-		if task.due.Before(today) || task.due.After(nextWeek) {
-			continue
-		}
-		if flag {
-			fmt.Println("\n-- Tasks Due soon ----")
-			flag = false
-		}
-		// PrintTask(i, task)
-		due := task.due.Format("2006-01-02")
-		fmt.Printf("%s (%s), ", task.title, due)
+// BackupDroppedLines copies the data file at path to path+".bak" if it has lines that can't be
+// loaded, as saving over it would lose them. Returns true if it made a backup.
+func BackupDroppedLines(path string) (bool, error) {
+	lines, err := CountTaskLines(path)
+	if err != nil {
+		return false, nil // no file yet, so nothing to lose
 	}
-	if !flag {
-		fmt.Println()
+	if tasks, err := LoadTasks(path); err != nil || len(tasks) == lines {
+		return false, nil
 	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	return true, os.WriteFile(path+".bak", data, 0644)
 }
 
-// SortTasksByDueDate sorts taskList by due date
-func SortTasksByDueDate() {
-	sortFunc := func(x, y Task) int {
-		return cmp.Compare(x.due.Format("2006-01-02"), y.due.Format("2006-01-02"))
+// parseTaskLine converts a v1 line from the data file into a Task, returning false if the line is malformed
+func parseTaskLine(str string) (Task, bool) {
+	if len(str) < 2 || str[0] != '"' || str[len(str)-1] != '"' {
+		return Task{}, false
 	}
-	taskList = slices.SortedStableFunc(slices.Values(taskList), sortFunc)
+	str = str[1 : len(str)-1] // Remove the leading and trailing quotes
+	return parseTaskFields(strings.Split(str, "\",\""))
 }
 
-// SortTasksByPriority sorts taskList by priority
-func SortTasksByPriority() {
-	sortFunc := func(x, y Task) int {
-		return cmp.Compare(x.priority, y.priority)
+// parseTaskFields converts the fields of a data file record into a Task, returning false
+// if there are too few. Columns after the original seven are optional so older files still load.
+func parseTaskFields(result []string) (Task, bool) {
+	if len(result) < 7 {
+		return Task{}, false
 	}
-	taskList = slices.SortedStableFunc(slices.Values(taskList), sortFunc)
+	dueDate, err := ParseDue(result[1])
+	badDue := ""
+	if err != nil {
+		badDue = result[1]
+	}
+	task := Task{
+		title:    result[0],
+		due:      dueDate,
+		priority: result[2],
+		repeat:   result[3],
+		label:    result[4],
+		done:     result[5],
+		notes:    result[6],
+		badDue:   badDue,
+	}
+	if len(result) > 7 && result[7] != "" {
+		task.completed, _ = time.ParseInLocation("2006-01-02 15:04", result[7], time.Local)
+	}
+	if len(result) > 8 {
+		task.repeatFromDone = result[8] == "Yes"
+	}
+	if len(result) > 9 {
+		task.subtasks = DecodeSubtasks(result[9])
+	}
+	if len(result) > 10 {
+		task.color = result[10]
+	}
+	if len(result) > 11 {
+		task.hiddenUntil = result[11]
+	}
+	if len(result) > 12 {
+		task.estimate, _ = strconv.Atoi(result[12]) // blank or invalid means no estimate
+	}
+	if len(result) > 13 {
+		task.created, _ = time.ParseInLocation("2006-01-02 15:04:05", result[13], time.Local)
+	}
+	if len(result) > 14 {
+		task.modified, _ = time.ParseInLocation("2006-01-02 15:04:05", result[14], time.Local)
+	}
+	if len(result) > 15 {
+		task.tentative = result[15] == "Yes"
+	}
+	return task, true
 }
 
-// SortTasksByName sorts taskList by name
-func SortTasksByName() {
-	sortFunc := func(x, y Task) int {
-		return cmp.Compare(x.title, y.title)
+// taskFields converts a Task into the fields of a data file record
+func taskFields(task Task) []string {
+	completed := ""
+	if !task.completed.IsZero() {
+		completed = task.completed.Format("2006-01-02 15:04")
 	}
-	taskList = slices.SortedStableFunc(slices.Values(taskList), sortFunc)
+	estimate := ""
+	if task.estimate > 0 {
+		estimate = strconv.Itoa(task.estimate)
+	}
+	due := FormatDue(task.due)
+	if task.due.IsZero() && task.badDue != "" { // not fixed yet, so keep what was there
+		due = task.badDue
+	}
+	return []string{task.title, due, task.priority, task.repeat, task.label, task.done, task.notes,
+		completed, yesNo(task.repeatFromDone), EncodeSubtasks(task.subtasks), task.color, task.hiddenUntil, estimate,
+		formatStamp(task.created), formatStamp(task.modified), yesNo(task.tentative)}
 }
 
-// SortTasks prompts user for sort option and sorts taskList accordingly
-func SortTasks() {
-	s := inputStr("Sort by (n)ame, (p)riority, (d)ue: ", 5)
-	switch strings.ToLower(s) {
-	case "n", "name":
-		SortTasksByName()
-	case "p", "priority":
-		SortTasksByPriority()
-	case "d", "due":
-		SortTasksByDueDate()
-	default:
-		fmt.Println("Invalid sort option!")
-		return
+// formatStamp formats a created or modified time for the data file, "" if not recorded
+func formatStamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
 	}
+	return t.Format("2006-01-02 15:04:05")
 }
 
-// UpdateRecurringTasks updates recurring tasks that are marked as done
+// touch records that a task was changed just now
+func touch(task *Task) {
+	task.modified = now()
+}
+
+// EncodeSubtasks stores subtasks in one field, eg. "[x] Buy paint|[ ] Paint fence"
+func EncodeSubtasks(subtasks []Subtask) string {
+	items := make([]string, len(subtasks))
+	for i, sub := range subtasks {
+		mark := "[ ] "
+		if sub.done {
+			mark = "[x] "
+		}
+		items[i] = mark + strings.ReplaceAll(sub.text, "|", "/")
+	}
+	return strings.Join(items, "|")
+}
+
+// DecodeSubtasks reads subtasks stored by EncodeSubtasks
+func DecodeSubtasks(field string) []Subtask {
+	if field == "" {
+		return nil
+	}
+	var subtasks []Subtask
+	for _, item := range strings.Split(field, "|") {
+		if text, ok := strings.CutPrefix(item, "[x] "); ok {
+			subtasks = append(subtasks, Subtask{text: text, done: true})
+		} else {
+			subtasks = append(subtasks, Subtask{text: strings.TrimPrefix(item, "[ ] ")})
+		}
+	}
+	return subtasks
+}
+
+// SubtaskProgress returns how many of a task's subtasks are done, and how many there are
+func SubtaskProgress(task Task) (int, int) {
+	done := 0
+	for _, sub := range task.subtasks {
+		if sub.done {
+			done++
+		}
+	}
+	return done, len(task.subtasks)
+}
+
+// EditSubtasks lists a task's subtasks and lets the user add or tick them off
+func EditSubtasks() {
+	if len(taskList) == 0 {
+		fmt.Println("No tasks to edit!")
+		return
+	}
+	id, ok := inputInt("Enter task ID for subtasks: ", 0, len(taskList)-1)
+	if !ok {
+		fmt.Println("Invalid task ID!")
+		return
+	}
+	task := &taskList[id]
+	for {
+		fmt.Println("\n----- Subtasks:", task.title, "-----")
+		for i, sub := range task.subtasks {
+			mark := "[ ]"
+			if sub.done {
+				mark = "[x]"
+			}
+			fmt.Printf("%d %s %s\n", i+1, mark, sub.text)
+		}
+		choice := strings.ToLower(inputStr("\n(a)dd, number to toggle, Enter to go back: ", 5))
+		switch choice {
+		case "":
+			return
+		case "a", "add":
+			text := inputStr("Subtask: ", 50)
+			if text != "" {
+				task.subtasks = append(task.subtasks, Subtask{text: text})
+				touch(task)
+				WriteAudit("edit", task.title)
+			}
+		default:
+			n, err := strconv.Atoi(choice)
+			if err != nil || n < 1 || n > len(task.subtasks) {
+				fmt.Println("Invalid subtask number!")
+				continue
+			}
+			task.subtasks[n-1].done = !task.subtasks[n-1].done
+			touch(task)
+			WriteAudit("edit", task.title)
+		}
+	}
+}
+
+var input = bufio.NewScanner(os.Stdin) // where typed input is read from, replaceable for testing
+
+// Input helper functions
+func inputStr(prompt string, length int) string { // input a string, limit length
+	fmt.Print(prompt)
+	input.Scan()
+	text := strings.TrimSpace(input.Text())
+	if len(text) > length {
+		return text[:length]
+	}
+	return text
+}
+
+// History is a fixed-size ring buffer of recent inputs, newest overwriting oldest
+type History struct {
+	items []string
+	next  int // where the next item goes
+	count int
+}
+
+func NewHistory(capacity int) *History {
+	return &History{items: make([]string, capacity)}
+}
+
+// Add stores an input, skipping blanks and repeats of the latest entry
+func (h *History) Add(s string) {
+	if s == "" || (h.count > 0 && h.Recall(1) == s) {
+		return
+	}
+	h.items[h.next] = s
+	h.next = (h.next + 1) % len(h.items)
+	h.count = min(h.count+1, len(h.items))
+}
+
+// Recall returns the nth most recent input (1 = latest), or "" if there isn't one
+func (h *History) Recall(n int) string {
+	if n < 1 || n > h.count {
+		return ""
+	}
+	return h.items[(h.next-n+len(h.items))%len(h.items)]
+}
+
+// Len returns the number of inputs held
+func (h *History) Len() int {
+	return h.count
+}
+
+var inputHistory = map[string]*History{} // per-session history for each kind of prompt
+
+func inputRecall(kind string, prompt string, length int) string { // input a string, "!" or "!n" recalls a recent entry
+	history, ok := inputHistory[kind]
+	if !ok {
+		history = NewHistory(5)
+		inputHistory[kind] = history
+	}
+	if history.Len() > 0 {
+		fmt.Print("Recent: ")
+		for n := 1; n <= history.Len(); n++ {
+			fmt.Printf("!%d %s  ", n, history.Recall(n))
+		}
+		fmt.Println()
+	}
+	text := inputStr(prompt, length)
+	if strings.HasPrefix(text, "!") && history.Len() > 0 {
+		n, err := strconv.Atoi(text[1:])
+		if text == "!" {
+			n, err = 1, nil
+		}
+		if recalled := history.Recall(n); err == nil && recalled != "" {
+			text = recalled
+			fmt.Println(text)
+		}
+	}
+	history.Add(text)
+	return text
+}
+
+func inputDone(prompt string) string { // input yes/no/doing, return "Yes", "No" or "Doing"
+	response := strings.ToLower(inputStr(prompt+" (y)es, (n)o or (d)oing: ", 5))
+	switch response {
+	case "y", "yes":
+		return "Yes"
+	case "d", "doing":
+		return "Doing"
+	}
+	return "No"
+}
+
+func yesNoInput(prompt string) string { // input yes/no, return "Yes" or "No"
+	response := strings.ToLower(inputStr(prompt+" (y/n): ", 5))
+	if response == "y" || response == "yes" {
+		return "Yes"
+	} else {
+		return "No"
+	}
+}
+
+// pause waits for the user to press Enter, so output isn't cleared before it's read
+func pause() {
+	inputStr("\nPress Enter to continue...", 1)
+}
+
+func yesNo(b bool) string { // convert a bool to "Yes" or "No" for storage
+	if b {
+		return "Yes"
+	}
+	return "No"
+}
+
+func inputLabel(prompt string) string { // input a label, picked by number from those in use or typed
+	labels := DistinctLabels(taskList)
+	for i, label := range labels {
+		fmt.Printf("%d %s  ", i+1, label)
+	}
+	if len(labels) > 0 {
+		fmt.Println()
+	}
+	return PickLabel(inputStr(prompt, 30), labels)
+}
+
+// PickLabel returns the label typed, or the one picked from labels by its listed number.
+// A number is only a pick if it is in the list's range and isn't itself a label in use,
+// so labels like "2025" can still be typed.
+func PickLabel(typed string, labels []string) string {
+	if slices.Contains(labels, typed) {
+		return typed
+	}
+	if n, err := strconv.Atoi(typed); err == nil && n >= 1 && n <= len(labels) {
+		return labels[n-1]
+	}
+	return typed
+}
+
+// DistinctLabels returns the sorted tags used by tasks, without duplicates
+func DistinctLabels(tasks []Task) []string {
+	var labels []string
+	for _, task := range tasks {
+		for _, tag := range SplitTags(task.label) {
+			if !slices.Contains(labels, tag) {
+				labels = append(labels, tag)
+			}
+		}
+	}
+	slices.Sort(labels)
+	return labels
+}
+
+// SplitTags splits a label into its comma-separated tags, eg. "work,urgent"
+func SplitTags(label string) []string {
+	var tags []string
+	for _, tag := range strings.Split(label, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// HasTag reports whether a label includes tag, ignoring case
+func HasTag(label string, tag string) bool {
+	return slices.ContainsFunc(SplitTags(label), func(t string) bool { return strings.EqualFold(t, tag) })
+}
+
+// ApplyLabel sets, or with appendTag adds, label on the tasks at ids, returning how many were changed
+func ApplyLabel(tasks []Task, ids []int, label string, appendTag bool) int {
+	count := 0
+	for _, i := range ids {
+		task := &tasks[i]
+		newLabel := label
+		if appendTag {
+			newLabel = task.label
+			for _, tag := range SplitTags(label) {
+				if !HasTag(newLabel, tag) {
+					newLabel = strings.Join(append(SplitTags(newLabel), tag), ",")
+				}
+			}
+		}
+		if newLabel != task.label {
+			task.label = newLabel
+			touch(task)
+			WriteAudit("edit", task.title)
+			count++
+		}
+	}
+	return count
+}
+
+// BulkLabel labels every task in the current view, replacing or adding to their labels
+func BulkLabel(filterBy string, query Query) {
+	label := inputStr("Label to apply: ", 30)
+	if label == "" {
+		return
+	}
+	appendTag := strings.ToLower(inputStr("(a)dd to existing labels or (r)eplace them? ", 10)) != "r"
+	ids := ViewIDs(taskList, filterBy, query, now())
+	if yesNoInput(fmt.Sprintf("Label %d tasks?", len(ids))) != "Yes" {
+		return
+	}
+	changed := ApplyLabel(taskList, ids, label, appendTag)
+	fmt.Printf("Changed the labels of %d tasks.\n", changed)
+	pause()
+}
+
+// ParseOffset reads a day offset like "+3d" or "+2w" (or "-1w" to bring tasks forward) as a number of days
+func ParseOffset(input string) (int, error) {
+	input = strings.ToLower(strings.TrimSpace(input))
+	if len(input) < 2 {
+		return 0, fmt.Errorf("invalid offset %q", input)
+	}
+	n, err := strconv.Atoi(input[:len(input)-1])
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("invalid offset %q", input)
+	}
+	switch input[len(input)-1] {
+	case 'd':
+		return n, nil
+	case 'w':
+		return 7 * n, nil
+	}
+	return 0, fmt.Errorf("invalid offset %q", input)
+}
+
+// ShiftLabel moves the due date of every not-done, dated task with the tag by days, returning how many moved
+func ShiftLabel(tasks []Task, tag string, days int) int {
+	count := 0
+	for i := range tasks {
+		task := &tasks[i]
+		if task.done == "Yes" || isUndated(task.due) || !HasTag(task.label, tag) {
+			continue
+		}
+		task.due = task.due.AddDate(0, 0, days)
+		touch(task)
+		WriteAudit("edit", task.title)
+		count++
+	}
+	return count
+}
+
+// RescheduleLabel pushes all the open tasks with a label forward, or back, together
+func RescheduleLabel() {
+	tag := inputLabel("Label to reschedule: ")
+	if tag == "" {
+		return
+	}
+	days, err := ParseOffset(inputStr("Move by (eg. +3d, +1w): ", 6))
+	if err != nil {
+		fmt.Println("Invalid offset, use eg. +3d or +1w!")
+		pause()
+		return
+	}
+	fmt.Printf("Rescheduled %d tasks.\n", ShiftLabel(taskList, tag, days))
+	pause()
+}
+
+type TagCount struct {
+	tag        string
+	open, done int
+}
+
+// TagSummary counts the open and done tasks carrying each tag, most open first
+func TagSummary(tasks []Task) []TagCount {
+	var counts []TagCount
+	for _, task := range tasks {
+		for _, tag := range SplitTags(task.label) {
+			i := slices.IndexFunc(counts, func(c TagCount) bool { return c.tag == tag })
+			if i < 0 {
+				counts = append(counts, TagCount{tag: tag})
+				i = len(counts) - 1
+			}
+			if task.done == "Yes" {
+				counts[i].done++
+			} else {
+				counts[i].open++
+			}
+		}
+	}
+	slices.SortStableFunc(counts, func(x, y TagCount) int {
+		return cmp.Or(cmp.Compare(y.open, x.open), cmp.Compare(x.tag, y.tag))
+	})
+	return counts
+}
+
+// PrintTagSummary prints how many open and done tasks carry each tag
+func PrintTagSummary() {
+	fmt.Printf("\n%-20s%6s%6s\n", "Tag", "Open", "Done")
+	fmt.Println(strings.Repeat("-", 32))
+	for _, c := range TagSummary(taskList) {
+		fmt.Printf("%-20s%6d%6d\n", c.tag, c.open, c.done)
+	}
+	pause()
+}
+
+func inputColor(prompt string) string { // input a color name, "" if blank or unknown
+	color := strings.ToLower(inputStr(prompt, 10))
+	if _, ok := colorNames[color]; !ok {
+		return ""
+	}
+	return color
+}
+
+func inputInt(prompt string, min int, max int) (int, bool) { // input an integer within a range, false if invalid
+	idx, err := strconv.Atoi(inputStr(prompt, 4))
+	if err != nil || idx < min || idx > max {
+		fmt.Printf("Number out of range (%d to %d).", min, max)
+		return 0, false
+	}
+	return idx, true
+}
+
+// add a new Task to taskList
+func addTask() {
+	fmt.Println("\n----- Add new task -----")
+	if config.maxTasks > 0 && len(taskList) >= config.maxTasks {
+		fmt.Printf("%sWarning: you have %d tasks (limit %d). Consider archiving done tasks.%s\n",
+			Yellow, len(taskList), config.maxTasks, Reset)
+	}
+
+	title := inputRecall("title", "Task title: ", maxTitleLength)
+	if title == "" {
+		fmt.Println("Task title cannot be empty!")
+		return
+	}
+
+	due := inputDueDate()
+	WarnBusyDay(due, 1) // the new task isn't in the list yet
+	priority := inputPriority("Priority (1 critical, 2 high, 3 low): ")
+	repeat := inputRepeat("Repeat (d)aily, (w)eekly, (m)onthly or eg. P2W: ")
+	repeatFromDone := false
+	if repeat != "" {
+		repeatFromDone = inputRepeatFromDone()
+	}
+
+	label := inputLabel("Labels (comma separated): ")
+	done := inputDone("Is the task done? ")
+	notes := inputRecall("notes", "Additional notes: ", 100)
+	estimate := inputEstimate("Estimate (eg. 30m, 2h, 1h30m; Enter for none): ")
+	tentative := yesNoInput("Is it tentative (someday/maybe)?") == "Yes"
+	color := inputColor("Color (red, green, yellow, blue, pink, cyan, white; Enter for default): ")
+
+	// Add the new task to the task list
+	task := Task{
+		title:          title,
+		due:            due,
+		priority:       priority,
+		repeat:         repeat,
+		label:          label,
+		notes:          notes,
+		repeatFromDone: repeatFromDone,
+		color:          color,
+		estimate:       estimate,
+		tentative:      tentative,
+		created:        now(),
+		modified:       now(),
+	}
+	setDone(&task, done)
+	taskList = append(taskList, task)
+	WriteAudit("add", task.title)
+}
+
+// CountDueOn returns how many not-done tasks are due on the same day as due
+func CountDueOn(tasks []Task, due time.Time) int {
+	count := 0
+	for _, task := range tasks {
+		if task.done != "Yes" && startOfDay(task.due).Equal(startOfDay(due)) {
+			count++
+		}
+	}
+	return count
+}
+
+// WarnBusyDay warns if, counting extra more tasks, at least config.busyDay tasks are due that day
+func WarnBusyDay(due time.Time, extra int) bool {
+	if config.busyDay == 0 || isUndated(due) {
+		return false
+	}
+	count := CountDueOn(taskList, due) + extra
+	if count < config.busyDay {
+		return false
+	}
+	fmt.Printf("%sHeads up: %d tasks are due on %s.%s\n", Yellow, count, due.Format("2006-01-02"), Reset)
+	return true
+}
+
+// inputDueDate asks for the due date of a new task, insisting on one if config.requireDueDate is set.
+// Typed due dates follow the same rule here and in inputNewDueDate: "none" or "-" means no due date,
+// a date or day name sets it, and anything else is asked again. Blank means no due date here
+// (unless config.explicitNoDue is set), and keeps the current date in inputNewDueDate.
+func inputDueDate() time.Time {
+	for {
+		input := inputStr("Due date (YYYY-MM-DD [HH:MM], a weekday, eg. 3 mar, or none): ", 16)
+		if input == "" && config.explicitNoDue {
+			fmt.Println("Type none for no due date!")
+			continue
+		}
+		if due, ok := checkDueInput(input, noDueDate); ok {
+			return due
+		}
+	}
+}
+
+// inputNewDueDate asks for a new due date for an existing task, blank keeping current
+func inputNewDueDate(current time.Time) time.Time {
+	for {
+		input := inputStr("New due date (YYYY-MM-DD [HH:MM], a weekday, eg. 3 mar, or none; Enter keeps it): ", 16)
+		if due, ok := checkDueInput(input, current); ok {
+			return due
+		}
+	}
+}
+
+// checkDueInput reads a typed due date with DueFromInput, explaining why it can't be used if not
+func checkDueInput(input string, blank time.Time) (time.Time, bool) {
+	due, ok := DueFromInput(input, blank)
+	if !ok {
+		fmt.Println("Invalid date!")
+		return due, false
+	}
+	if isUndated(due) && config.requireDueDate {
+		fmt.Println("A due date is required!")
+		return due, false
+	}
+	return due, true
+}
+
+// DueFromInput applies the due date rule to input, returning blank for blank input.
+// Returns false if the input can't be read as a date.
+func DueFromInput(input string, blank time.Time) (time.Time, bool) {
+	input = strings.TrimSpace(input)
+	switch strings.ToLower(input) {
+	case "":
+		return blank, true
+	case "none", "-":
+		return noDueDate, true
+	}
+	due, err := ParseDueInput(input)
+	if err != nil {
+		return blank, false
+	}
+	return due, true
+}
+
+// inputEstimate asks how long a task will take, re-asking if the answer can't be read
+func inputEstimate(prompt string) int {
+	for {
+		minutes, err := ParseEstimate(inputStr(prompt, 10))
+		if err == nil {
+			return minutes
+		}
+		fmt.Println("Invalid estimate, use eg. 30m, 2h or 1h30m!")
+	}
+}
+
+// ParseEstimate converts an estimate like "30m", "2h" or "1h30m" to minutes; a bare number is minutes.
+// Blank means no estimate.
+func ParseEstimate(input string) (int, error) {
+	input = strings.ToLower(strings.TrimSpace(input))
+	if input == "" {
+		return 0, nil
+	}
+	if minutes, err := strconv.Atoi(input); err == nil && minutes >= 0 {
+		return minutes, nil
+	}
+	d, err := time.ParseDuration(input)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid estimate %q", input)
+	}
+	return int(d.Round(time.Minute).Minutes()), nil
+}
+
+// FormatEstimate shows minutes as eg. "45m", "2h" or "1h30m", or "" for no estimate
+func FormatEstimate(minutes int) string {
+	switch {
+	case minutes <= 0:
+		return ""
+	case minutes < 60:
+		return fmt.Sprintf("%dm", minutes)
+	case minutes%60 == 0:
+		return fmt.Sprintf("%dh", minutes/60)
+	}
+	return fmt.Sprintf("%dh%02dm", minutes/60, minutes%60)
+}
+
+// TotalEstimate adds up the estimates of the not-done tasks at ids, and counts those without one
+func TotalEstimate(tasks []Task, ids []int) (minutes int, unestimated int) {
+	for _, i := range ids {
+		task := tasks[i]
+		if task.done == "Yes" {
+			continue
+		}
+		if task.estimate == 0 {
+			unestimated++
+		}
+		minutes += task.estimate
+	}
+	return minutes, unestimated
+}
+
+// PrintEstimate shows the total estimated work left in the current view
+func PrintEstimate(filterBy string, query Query) {
+	minutes, unestimated := TotalEstimate(taskList, ViewIDs(taskList, filterBy, query, now()))
+	if minutes == 0 {
+		fmt.Println("No estimated work left!")
+	} else {
+		fmt.Println("Estimated work left:", FormatEstimate(minutes))
+	}
+	if unestimated > 0 {
+		fmt.Printf("%d not-done tasks have no estimate.\n", unestimated)
+	}
+	pause()
+}
+
+// inputPriority asks for a priority by number or name, defaulting to 3, re-asking if unknown
+func inputPriority(prompt string) string {
+	for {
+		input := inputStr(prompt, 10)
+		if input == "" {
+			return "3" // default priority
+		}
+		priority, err := ParsePriority(input)
+		if err == nil {
+			return priority
+		}
+		fmt.Printf("Try again, %v!\n", err)
+	}
+}
+
+var priorityNames = []struct { // names that can be typed for a priority
+	name     string
+	priority string
+}{{"critical", "1"}, {"high", "2"}, {"medium", "2"}, {"low", "3"}}
+
+// ParsePriority turns "1" to "3", or a priority name or the start of one, into the stored priority.
+// There are only three levels, so high and medium are both 2.
+func ParsePriority(input string) (string, error) {
+	input = strings.ToLower(strings.TrimSpace(input))
+	if input == "1" || input == "2" || input == "3" {
+		return input, nil
+	}
+	found := ""
+	for _, p := range priorityNames {
+		if input != "" && strings.HasPrefix(p.name, input) {
+			if input == p.name {
+				return p.priority, nil
+			}
+			if found != "" && found != p.priority {
+				return "", fmt.Errorf("%q could be more than one priority, type more of it", input)
+			}
+			found = p.priority
+		}
+	}
+	if found == "" {
+		return "", fmt.Errorf("unknown priority %q, use 1, 2, 3 or critical, high, medium, low", input)
+	}
+	return found, nil
+}
+
+// PriorityName returns the name shown for a stored priority, eg. "high" for "2"
+func PriorityName(priority string) string {
+	for _, p := range priorityNames { // medium is only an alias, so high is found first
+		if p.priority == priority {
+			return p.name
+		}
+	}
+	return ""
+}
+
+// inputRepeat asks how often a task repeats, returning "" if it doesn't.
+// Accepts the words or an ISO 8601 duration like P2W, re-asking if the duration is invalid.
+func inputRepeat(prompt string) string {
+	for {
+		repeat, err := ParseRepeat(inputStr(prompt, 10))
+		if err == nil {
+			return repeat
+		}
+		fmt.Println("Invalid repeat:", err)
+	}
+}
+
+// ParseRepeat converts repeat input into the stored form: "Daily", "Weekly",
+// "Monthly", an ISO 8601 duration such as "P3M", or "" for no repeat
+func ParseRepeat(input string) (string, error) {
+	input = strings.ToUpper(strings.TrimSpace(input))
+	switch input {
+	case "D", "DAILY", "P1D":
+		return "Daily", nil
+	case "W", "WEEKLY", "P1W":
+		return "Weekly", nil
+	case "M", "MONTHLY", "P1M":
+		return "Monthly", nil
+	}
+	if !strings.HasPrefix(input, "P") {
+		return "", nil // anything else means no repeat
+	}
+	if _, _, _, ok := RepeatInterval(input); !ok {
+		return "", fmt.Errorf("%q is not a valid duration, use eg. P1D, P2W, P3M or P1Y", input)
+	}
+	return input, nil
+}
+
+// RepeatInterval returns the years, months and days between occurrences of a repeat
+// value, which is one of the words or a single-unit ISO 8601 duration (PnD, PnW, PnM, PnY)
+func RepeatInterval(repeat string) (years, months, days int, ok bool) {
+	switch repeat {
+	case "Daily":
+		return 0, 0, 1, true
+	case "Weekly":
+		return 0, 0, 7, true
+	case "Monthly":
+		return 0, 1, 0, true
+	}
+	if len(repeat) < 3 || repeat[0] != 'P' {
+		return 0, 0, 0, false
+	}
+	n, err := strconv.Atoi(repeat[1 : len(repeat)-1])
+	if err != nil || n < 1 || n > 999 {
+		return 0, 0, 0, false
+	}
+	switch repeat[len(repeat)-1] {
+	case 'D':
+		return 0, 0, n, true
+	case 'W':
+		return 0, 0, 7 * n, true
+	case 'M':
+		return 0, n, 0, true
+	case 'Y':
+		return n, 0, 0, true
+	}
+	return 0, 0, 0, false
+}
+
+// inputRepeatFromDone asks whether a recurring task advances from its due or completion date
+func inputRepeatFromDone() bool {
+	from := strings.ToLower(inputStr("Repeat from (d)ue date or (c)ompletion date: ", 10))
+	return from == "c" || from == "completion"
+}
+
+// setDone sets a task's done status, recording the completion time when it becomes done,
+// and marks the task modified
+func setDone(task *Task, done string) {
+	if done == "Yes" && task.done != "Yes" {
+		task.completed = now()
+	}
+	task.done = done
+	touch(task)
+}
+
+// AddInboxTask captures a task with just a title, labelled "inbox" to be triaged later
+func AddInboxTask() {
+	title := inputRecall("title", "Inbox task title: ", maxTitleLength)
+	if title == "" {
+		return
+	}
+	taskList = append(taskList, NewInboxTask(title))
+	WriteAudit("add", title)
+}
+
+// NewInboxTask returns an undated task with the default priority and the "inbox" label
+func NewInboxTask(title string) Task {
+	return Task{title: title, due: noDueDate, priority: "3", label: "inbox", done: "No", created: now(), modified: now()}
+}
+
+// TriageInbox walks through the inbox tasks one at a time, asking for their remaining details
+func TriageInbox() {
+	count := 0
+	for i := range taskList {
+		task := &taskList[i]
+		if task.label != "inbox" || task.done == "Yes" {
+			continue
+		}
+		count++
+		fmt.Println("\n----- Triage:", task.title, "-----")
+		choice := strings.ToLower(inputStr("(t)riage, (s)kip or (q)uit triage? ", 5))
+		if choice == "q" || choice == "quit" {
+			return
+		}
+		if choice != "t" && choice != "triage" {
+			continue
+		}
+		task.due = inputDueDate()
+		task.priority = inputPriority("Priority (1 critical, 2 high, 3 low): ")
+		task.repeat = inputRepeat("Repeat (d)aily, (w)eekly, (m)onthly or eg. P2W: ")
+		task.repeatFromDone = task.repeat != "" && inputRepeatFromDone()
+		task.label = inputLabel("Labels (comma separated): ")
+		task.notes = inputRecall("notes", "Additional notes: ", 100)
+		touch(task)
+		WriteAudit("edit", task.title)
+	}
+	if count == 0 {
+		fmt.Println("The inbox is empty!")
+		pause()
+	}
+}
+
+// EditTask edits an existing task in taskList
+func EditTask() {
+	if len(taskList) == 0 {
+		fmt.Println("No tasks to edit!")
+		return
+	}
+	id, ok := inputInt("Enter task ID to edit: ", 0, len(taskList)-1)
+	if !ok {
+		fmt.Println("Invalid task ID!")
+		return
+	}
+	EditTaskID(id)
+}
+
+// EditTaskID edits the task at id, asking which field to change
+func EditTaskID(id int) {
+	task := &taskList[id] // get pointer to the task to edit
+	fmt.Println("\n----- Edit task -----")
+	fmt.Println("1 Title:", task.title)
+	due := FormatDue(task.due)
+	if isUndated(task.due) {
+		due = ""
+	}
+	fmt.Println("2 Due date:", due)
+	fmt.Println("3 Priority:", task.priority, PriorityName(task.priority))
+	repeat := task.repeat
+	if repeat != "" && task.repeatFromDone {
+		repeat += " (from completion)"
+	}
+	fmt.Println("4 Repeat:", repeat)
+	fmt.Println("5 Label:", task.label)
+	fmt.Println("6 Done:", task.done)
+	fmt.Println("7 Notes:", task.notes)
+	fmt.Println("8 Color:", task.color)
+	fmt.Println("9 Hidden until done:", task.hiddenUntil)
+	fmt.Println("10 Estimate:", FormatEstimate(task.estimate))
+	fmt.Println("11 Tentative:", yesNo(task.tentative))
+	choice, err := ParseFieldChoice(inputStr("\nNumber of field to edit (Enter or 0 cancels): ", 4), 11)
+	if err != nil {
+		fmt.Printf("Invalid choice, %v!\n", err)
+		return
+	}
+
+	switch choice { // 0 means cancelled, leaving the task as it was
+	case 1:
+		newTitle := inputRecall("title", "New title: ", maxTitleLength)
+		if newTitle != "" {
+			task.title = newTitle
+		}
+	case 2:
+		due := inputNewDueDate(task.due)
+		changed := !due.Equal(task.due)
+		task.due = due
+		if changed && task.done != "Yes" && WarnBusyDay(due, 0) {
+			pause()
+		}
+	case 3:
+		task.priority = inputPriority("New priority (1 critical, 2 high, 3 low): ")
+	case 4:
+		task.repeat = inputRepeat("New (d)aily, (w)eekly, (m)onthly or eg. P2W: ")
+		task.repeatFromDone = task.repeat != "" && inputRepeatFromDone()
+	case 5:
+		task.label = inputLabel("New labels (comma separated): ")
+	case 6:
+		setDone(task, inputDone("Is the task done? "))
+	case 7:
+		task.notes = inputRecall("notes", "Additional notes: ", 100)
+	case 8:
+		task.color = inputColor("New color (red, green, yellow, blue, pink, cyan, white; Enter for default): ")
+	case 9:
+		task.hiddenUntil = inputStr("Hide until this task is done (title, Enter for never): ", maxTitleLength)
+	case 10:
+		task.estimate = inputEstimate("New estimate (eg. 30m, 2h, 1h30m; Enter for none): ")
+	case 11:
+		task.tentative = yesNoInput("Is it tentative (someday/maybe)?") == "Yes"
+	}
+	if choice != 0 {
+		touch(task)
+		WriteAudit("edit", task.title)
+	}
+}
+
+// ParseFieldChoice reads the number of a field to edit, from 1 to max.
+// Blank or "0" cancels cleanly, returning 0 and no error; anything else invalid is an error.
+func ParseFieldChoice(input string, max int) (int, error) {
+	input = strings.TrimSpace(input)
+	if input == "" || input == "0" {
+		return 0, nil
+	}
+	choice, err := strconv.Atoi(input)
+	if err != nil || choice < 1 || choice > max {
+		return 0, fmt.Errorf("number out of range (1 to %d)", max)
+	}
+	return choice, nil
+}
+
+// IsHidden reports whether a task is waiting for the task named by its hiddenUntil
+// to be done. It is shown again once that task is done, or if no task has that title.
+func IsHidden(task Task, tasks []Task) bool {
+	if task.hiddenUntil == "" {
+		return false
+	}
+	return slices.ContainsFunc(tasks, func(t Task) bool {
+		return t.done != "Yes" && strings.EqualFold(t.title, task.hiddenUntil)
+	})
+}
+
+// NormalizeDates re-reads due dates that couldn't be read when the file was loaded, and if dropTimes
+// is set also moves timed due dates to midnight. It returns how many were changed and the IDs of
+// the ones that still can't be read.
+func NormalizeDates(tasks []Task, dropTimes bool) (normalized int, unreadable []int) {
+	for i := range tasks {
+		task := &tasks[i]
+		due := task.due
+		if task.due.IsZero() {
+			parsed, err := ParseLooseDue(task.badDue)
+			if err != nil {
+				unreadable = append(unreadable, i)
+				continue
+			}
+			due = parsed.Truncate(time.Minute) // due times are kept to the minute
+		}
+		if dropTimes {
+			due = startOfDay(due)
+		}
+		if due.Equal(task.due) {
+			continue // already a clean date
+		}
+		task.due, task.badDue = due, ""
+		touch(task)
+		WriteAudit("edit", task.title)
+		normalized++
+	}
+	return normalized, unreadable
+}
+
+// FixDates normalizes the due dates in taskList, asking before dropping any times of day,
+// lists any it couldn't read, and saves
+func FixDates() {
+	fmt.Println("\nThis re-reads due dates that were written in another format.")
+	timed := 0
+	for _, task := range taskList {
+		if hasTime(task.due) {
+			timed++
+		}
+	}
+	dropTimes := false
+	if timed > 0 {
+		dropTimes = yesNoInput(fmt.Sprintf("Also drop the time of day from %d due dates?", timed)) == "Yes"
+	}
+	normalized, unreadable := NormalizeDates(taskList, dropTimes)
+	fmt.Printf("Normalized %d due dates.\n", normalized)
+	if len(unreadable) > 0 {
+		fmt.Printf("%sCould not read %d due dates, please edit these tasks:%s\n", Yellow, len(unreadable), Reset)
+		for _, i := range unreadable {
+			fmt.Printf("%d %s (%q)\n", i, taskList[i].title, taskList[i].badDue)
+		}
+	}
+	if normalized > 0 && WriteTasksFile() != nil {
+		SaveElsewhere()
+	}
+	pause()
+}
+
+// MarkAllDone marks every not-done task in the view done, except tentative ones, returning how many
+func MarkAllDone(tasks []Task, filterBy string, query Query) int {
+	count := 0
+	for _, i := range ViewIDs(tasks, filterBy, query, now()) {
+		task := &tasks[i]
+		if task.done == "Yes" || task.tentative {
+			continue
+		}
+		setDone(task, "Yes")
+		WriteAudit("done", task.title)
+		count++
+	}
+	return count
+}
+
+// AllDone asks before marking every task in the current view done
+func AllDone(filterBy string, query Query) {
+	if yesNoInput("Mark all tasks in this view done (tentative tasks are skipped)?") != "Yes" {
+		return
+	}
+	fmt.Printf("Marked %d tasks done.\n", MarkAllDone(taskList, filterBy, query))
+	pause()
+}
+
+// ViewTask prompts for a task ID and shows everything about that task
+func ViewTask() {
+	if len(taskList) == 0 {
+		fmt.Println("No tasks to view!")
+		return
+	}
+	id, ok := inputInt("Enter task ID to view: ", 0, len(taskList)-1)
+	if !ok {
+		fmt.Println("Invalid task ID!")
+		return
+	}
+	ViewTaskID(id)
+}
+
+// ViewTaskID shows every field of the task at id
+func ViewTaskID(id int) {
+	task := taskList[id]
+	due := FormatDue(task.due)
+	if isUndated(task.due) {
+		due = ""
+	}
+	fmt.Println("\n----- Task", id, "-----")
+	fmt.Println("Title:", task.title)
+	fmt.Println("Due date:", due)
+	fmt.Println("Priority:", task.priority, PriorityName(task.priority))
+	fmt.Println("Repeat:", task.repeat)
+	fmt.Println("Label:", task.label)
+	fmt.Println("Done:", task.done)
+	fmt.Println("Notes:", task.notes)
+	for _, sub := range task.subtasks {
+		mark := "[ ]"
+		if sub.done {
+			mark = "[x]"
+		}
+		fmt.Println("  ", mark, sub.text)
+	}
+	if task.estimate > 0 {
+		fmt.Println("Estimate:", FormatEstimate(task.estimate))
+	}
+	if !task.created.IsZero() {
+		fmt.Println("Created:", formatStamp(task.created))
+	}
+	pause()
+}
+
+// ParseShortcut splits a command like "e3" into its letter and task ID. Only e, d, r and v
+// take an ID this way, and it must be all digits; ok is false for anything else.
+func ParseShortcut(choice string) (command string, id int, ok bool) {
+	if len(choice) < 2 || !strings.Contains("edrv", choice[:1]) {
+		return "", 0, false
+	}
+	digits := choice[1:]
+	if strings.Trim(digits, "0123456789") != "" {
+		return "", 0, false
+	}
+	id, err := strconv.Atoi(digits)
+	if err != nil { // too big to be an ID
+		return "", 0, false
+	}
+	return choice[:1], id, true
+}
+
+// ParseTop reads a "top N" command, ok is false for anything else. N of 0 shows every task again.
+func ParseTop(choice string) (n int, ok bool) {
+	arg, found := strings.CutPrefix(choice, "top ")
+	if !found {
+		return 0, false
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(arg))
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// LimitRows keeps the first limit rows of the groups, dropping groups left empty, and returns how
+// many rows were left out. A task under several labels is a row in each. A limit of 0 keeps them all.
+func LimitRows(groups []LabelGroup, limit int) ([]LabelGroup, int) {
+	if limit <= 0 {
+		return groups, 0
+	}
+	var kept []LabelGroup
+	more := 0
+	for _, group := range groups {
+		n := min(len(group.ids), limit)
+		if n > 0 {
+			kept = append(kept, LabelGroup{group.label, group.ids[:n]})
+		}
+		limit -= n
+		more += len(group.ids) - n
+	}
+	return kept, more
+}
+
+// InView reports whether a task is shown in the list when it is filtered by a label tag and a query
+func InView(task Task, tasks []Task, filterBy string, query Query, now time.Time) bool {
+	return (filterBy == "" || HasTag(task.label, filterBy)) && !IsHidden(task, tasks) && query.Match(task, now)
+}
+
+// ViewIDs returns the indexes of the tasks shown in the list when it is filtered by a label tag and a
+// query. Commands acting on the current view use it, so they change the tasks that are on screen.
+func ViewIDs(tasks []Task, filterBy string, query Query, now time.Time) []int {
+	var ids []int
+	for i, task := range tasks {
+		if InView(task, tasks, filterBy, query, now) {
+			ids = append(ids, i)
+		}
+	}
+	return ids
+}
+
+// ListTasks lists all tasks, optionally filtered by a label tag and a query, and grouped by label.
+// If top is more than 0 only the first top rows of the view are shown, with a count of the rest.
+func ListTasks(filterBy string, query Query, grouped bool, top int) {
+	fmt.Print("\033[H\033[2J") // clear the terminal screen
+	fmt.Println(config.header)
+	if len(taskList) == 0 {
+		fmt.Println("No tasks found. Create one now!")
+		return
+	}
+	listColumns = ChooseColumns(TerminalWidth())
+	PrintTitleHeader()
+	ids := ViewIDs(taskList, filterBy, query, now())
+	groups := []LabelGroup{{"", ids}}
+	if grouped {
+		groups = GroupByLabel(taskList, ids)
+	}
+	groups, more := LimitRows(groups, top)
+	for _, group := range groups {
+		if grouped {
+			fmt.Println("\n== " + group.label + " ==")
+		}
+		for _, i := range group.ids {
+			PrintTask(i, taskList[i])
+		}
+	}
+	if more > 0 {
+		fmt.Printf("(… and %d more)\n", more)
+	}
+}
+
+type LabelGroup struct { // tasks listed under one label
+	label string
+	ids   []int
+}
+
+// GroupByLabel groups the tasks at ids under each of their tags, sorted, with untagged tasks last
+// under "(no label)". A task with several tags appears under each, and the list order is kept.
+func GroupByLabel(tasks []Task, ids []int) []LabelGroup {
+	var groups []LabelGroup
+	var unlabelled []int
+	for _, i := range ids {
+		tags := SplitTags(tasks[i].label)
+		if len(tags) == 0 {
+			unlabelled = append(unlabelled, i)
+		}
+		for _, tag := range tags {
+			g := slices.IndexFunc(groups, func(group LabelGroup) bool { return group.label == tag })
+			if g < 0 {
+				groups = append(groups, LabelGroup{label: tag})
+				g = len(groups) - 1
+			}
+			groups[g].ids = append(groups[g].ids, i)
+		}
+	}
+	slices.SortFunc(groups, func(a, b LabelGroup) int { return cmp.Compare(a.label, b.label) })
+	if len(unlabelled) > 0 {
+		groups = append(groups, LabelGroup{"(no label)", unlabelled})
+	}
+	return groups
+}
+
+type ListCounts struct { // how many tasks in a view are in each state
+	total   int
+	overdue int
+	today   int
+	doing   int
+	done    int
+}
+
+// CountTasks counts the tasks shown in the view, by the states ListTasks colors them in
+func CountTasks(tasks []Task, filterBy string, query Query, now time.Time) ListCounts {
+	var counts ListCounts
+	for _, task := range tasks {
+		if !InView(task, tasks, filterBy, query, now) {
+			continue
+		}
+		counts.total++
+		if task.done == "Doing" {
+			counts.doing++ // in progress tasks can be overdue or due today too
+		}
+		switch urgency := ClassifyTask(task, now); {
+		case urgency == UrgencyDone:
+			counts.done++
+		case urgency == UrgencyOverdue:
+			counts.overdue++
+		case urgency == UrgencyToday:
+			counts.today++
+		}
+	}
+	return counts
+}
+
+// StatusLine summarises a view, eg. "12 tasks · 3 overdue · 2 today · 1 doing · 5 done · filter: work".
+// When minimal, zero counts are left out to fit narrow terminals.
+func StatusLine(counts ListCounts, filterBy string, query Query, minimal bool) string {
+	parts := []string{fmt.Sprintf("%d tasks", counts.total)}
+	for _, part := range []struct {
+		count int
+		name  string
+		color string
+	}{{counts.overdue, "overdue", Red}, {counts.today, "today", Blue}, {counts.doing, "doing", Yellow}, {counts.done, "done", Green}} {
+		if minimal && part.count == 0 {
+			continue
+		}
+		text := fmt.Sprintf("%d %s", part.count, part.name)
+		if part.count > 0 {
+			text = colorize(text, part.color, 0)
+		}
+		parts = append(parts, text)
+	}
+	if filterBy != "" {
+		parts = append(parts, "filter: "+filterBy)
+	}
+	if query.text != "" {
+		parts = append(parts, "query: "+query.text)
+	}
+	return strings.Join(parts, " · ")
+}
+
+// PrintStatusLine prints the status line for the current view below the list
+func PrintStatusLine(filterBy string, query Query) {
+	if len(taskList) == 0 {
+		return
+	}
+	minimal := len(listColumns) == len(minimalColumns)
+	fmt.Println("\n" + StatusLine(CountTasks(taskList, filterBy, query, now()), filterBy, query, minimal))
+}
+
+type Query struct { // a filter like "priority<=2 and done=No or label=work"
+	text string
+	any  [][]Condition // matches if all the conditions in any group match
+}
+
+type Condition struct { // one comparison in a query, eg. priority<=2
+	field string
+	op    string
+	value string
+}
+
+var queryFields = []string{"priority", "done", "label", "due"}
+
+// ParseQuery reads a query: comparisons of priority, done, label or due with =, !=, <, <=, > or >=,
+// joined by "and" and "or". "and" binds tighter, so "a or b and c" means a, or both b and c.
+// Blank gives an empty query, matching every task.
+func ParseQuery(text string) (Query, error) {
+	query := Query{text: strings.TrimSpace(text)}
+	if query.text == "" {
+		return query, nil
+	}
+	var group []Condition
+	var words []string
+	finish := func() error { // add the condition made of words to the group
+		if len(words) == 0 {
+			return fmt.Errorf("missing comparison in %q", query.text)
+		}
+		cond, err := ParseCondition(strings.Join(words, " "))
+		if err != nil {
+			return err
+		}
+		group = append(group, cond)
+		words = nil
+		return nil
+	}
+	for _, word := range strings.Fields(query.text) {
+		switch strings.ToLower(word) {
+		case "and":
+			if err := finish(); err != nil {
+				return Query{}, err
+			}
+		case "or":
+			if err := finish(); err != nil {
+				return Query{}, err
+			}
+			query.any = append(query.any, group)
+			group = nil
+		default:
+			words = append(words, word)
+		}
+	}
+	if err := finish(); err != nil {
+		return Query{}, err
+	}
+	query.any = append(query.any, group)
+	return query, nil
+}
+
+// ParseCondition reads one comparison, eg. "priority<=2" or "label = work"
+func ParseCondition(text string) (Condition, error) {
+	i := strings.IndexAny(text, "=!<>")
+	if i < 0 {
+		return Condition{}, fmt.Errorf("no comparison in %q, use eg. priority<=2", text)
+	}
+	cond := Condition{field: strings.ToLower(strings.TrimSpace(text[:i]))}
+	rest := text[i:]
+	for _, op := range []string{"<=", ">=", "!=", "=", "<", ">"} { // two character operators first
+		if strings.HasPrefix(rest, op) {
+			cond.op = op
+			cond.value = strings.TrimSpace(rest[len(op):])
+			break
+		}
+	}
+	switch {
+	case !slices.Contains(queryFields, cond.field):
+		return Condition{}, fmt.Errorf("unknown field %q, use %s", cond.field, strings.Join(queryFields, ", "))
+	case cond.op == "":
+		return Condition{}, fmt.Errorf("unknown comparison in %q", text)
+	case cond.value == "":
+		return Condition{}, fmt.Errorf("missing value in %q", text)
+	case (cond.field == "done" || cond.field == "label") && cond.op != "=" && cond.op != "!=":
+		return Condition{}, fmt.Errorf("%s can only be compared with = or !=", cond.field)
+	}
+	switch cond.field {
+	case "priority":
+		priority, err := ParsePriority(cond.value)
+		if err != nil {
+			return Condition{}, err
+		}
+		cond.value = priority
+	case "done":
+		done, ok := map[string]string{"yes": "Yes", "no": "No", "doing": "Doing"}[strings.ToLower(cond.value)]
+		if !ok {
+			return Condition{}, fmt.Errorf("done %q is not Yes, No or Doing", cond.value)
+		}
+		cond.value = done
+	case "due":
+		if !strings.EqualFold(cond.value, "none") {
+			if _, err := ParseDueInput(cond.value); err != nil {
+				return Condition{}, fmt.Errorf("%q is not a date", cond.value)
+			}
+		}
+	}
+	return cond, nil
+}
+
+// Match reports whether task matches the query, always true for an empty query
+func (q Query) Match(task Task, now time.Time) bool {
+	if len(q.any) == 0 {
+		return true
+	}
+	for _, group := range q.any {
+		if !slices.ContainsFunc(group, func(c Condition) bool { return !c.Match(task, now) }) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether task satisfies the condition. Due dates compare by day, and a task
+// with no due date counts as due after every date, or matches due=none.
+func (c Condition) Match(task Task, now time.Time) bool {
+	var order int
+	switch c.field {
+	case "priority":
+		order = strings.Compare(task.priority, c.value)
+	case "done":
+		order = strings.Compare(strings.ToLower(task.done), strings.ToLower(c.value))
+	case "label":
+		order = 1
+		if HasTag(task.label, c.value) {
+			order = 0
+		}
+	case "due":
+		due := noDueDate
+		if day, ok := ParseDayName(c.value, currentLocale(), now); ok {
+			due = day
+		} else if day, ok := ParseMonthDate(c.value, currentLocale(), now); ok {
+			due = day
+		} else if !strings.EqualFold(c.value, "none") {
+			due, _ = ParseDue(c.value) // checked by ParseCondition
+		}
+		order = startOfDay(task.due).Compare(startOfDay(due))
+	}
+	switch c.op {
+	case "=":
+		return order == 0
+	case "!=":
+		return order != 0
+	case "<":
+		return order < 0
+	case "<=":
+		return order <= 0
+	case ">":
+		return order > 0
+	}
+	return order >= 0
+}
+
+// QueryTasks asks for a query to narrow the list, blank clearing it
+func QueryTasks(current Query) Query {
+	if current.text != "" {
+		fmt.Println("Current query:", current.text)
+	}
+	text := inputStr("Query (eg. priority<=2 and done=No; Enter clears): ", 100)
+	query, err := ParseQuery(text)
+	if err != nil {
+		fmt.Println("Invalid query:", err)
+		pause()
+		return current
+	}
+	return query
+}
+
+type DoneMarkers struct { // how the Done column shows each state; the data file always has Yes/No/Doing
+	header string
+	yes    string
+	no     string
+	doing  string
+}
+
+var doneMarkerStyles = map[string]DoneMarkers{
+	"words": {"Done", "Yes", "No", "Doing"},
+	"check": {"Done", "✓", "✗", "…"},
+	"box":   {"[x]", "[x]", "[ ]", "[~]"},
+}
+
+// doneStyle returns the configured done markers, words if unset
+func doneStyle() DoneMarkers {
+	if markers, ok := doneMarkerStyles[config.doneMarkers]; ok {
+		return markers
+	}
+	return doneMarkerStyles["words"]
+}
+
+// DoneMarker returns how a done value is shown in the configured style
+func DoneMarker(done string) string {
+	markers := doneStyle()
+	switch done {
+	case "Yes":
+		return markers.yes
+	case "Doing":
+		return markers.doing
+	}
+	return markers.no
+}
+
+type Column struct {
+	name  string
+	width int
+}
+
+var allColumns = []Column{{"ID", 3}, {"Title", 20}, {"Due", 17}, {"Prty", 6}, {"Repeat", 10}, {"Label", 11}, {"Done", 6}}
+var minimalColumns = []Column{{"ID", 3}, {"Title", 20}, {"Due", 17}}
+var listColumns = allColumns // columns shown by PrintTitleHeader and PrintTask
+
+// ChooseColumns drops the Repeat and then the Label column, or falls back
+// to the minimal ID/Title/Due layout, until a row fits within width
+func ChooseColumns(width int) []Column {
+	noRepeat := slices.DeleteFunc(slices.Clone(allColumns), func(c Column) bool { return c.name == "Repeat" })
+	noLabel := slices.DeleteFunc(slices.Clone(noRepeat), func(c Column) bool { return c.name == "Label" })
+	for _, columns := range [][]Column{allColumns, noRepeat, noLabel} {
+		if columnsWidth(columns) <= width {
+			return columns
+		}
+	}
+	return minimalColumns
+}
+
+// columnsWidth returns the total width of a row made of columns
+func columnsWidth(columns []Column) int {
+	total := 0
+	for _, c := range columns {
+		total += c.width
+	}
+	return total
+}
+
+var sttyWidth int // terminal width found by stty, 0 until TerminalWidth first asks
+
+// TerminalWidth returns the width of the terminal from $COLUMNS or stty, or 80 if unknown.
+// stty is only run once, rather than every time the list is shown.
+func TerminalWidth() int {
+	if width, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && width > 0 {
+		return width
+	}
+	if sttyWidth == 0 {
+		sttyWidth = SttyWidth()
+	}
+	return sttyWidth
+}
+
+// SttyWidth asks stty for the width of the terminal, returning 80 if it can't tell
+func SttyWidth() int {
+	cmd := exec.Command("stty", "size")
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	if err == nil {
+		fields := strings.Fields(string(out)) // "rows columns"
+		if len(fields) == 2 {
+			if width, err := strconv.Atoi(fields[1]); err == nil && width > 0 {
+				return width
+			}
+		}
+	}
+	return 80
+}
+
+// PrintTitleHeader prints the header for the task list
+func PrintTitleHeader() {
+	fmt.Print("\n" + FormatHeader(listColumns))
+}
+
+// FormatHeader returns the column names and underline for a task list
+func FormatHeader(columns []Column) string {
+	header := ""
+	for _, c := range columns {
+		name := c.name
+		if name == "Done" {
+			name = doneStyle().header
+		}
+		header += fmt.Sprintf("%-*s", c.width, name)
+	}
+	return header + "\n" + strings.Repeat("-", columnsWidth(columns)) + "\n"
+}
+
+// PrintTask prints a single task with color coding
+func PrintTask(i int, task Task) {
+	fmt.Println(FormatRow(listColumns, i, task, TaskColor(task, now())))
+}
+
+// TaskColor returns the color to show a task in. Overdue comes first, then the
+// task's own color, then done and due today.
+func TaskColor(task Task, now time.Time) string {
+	urgency := ClassifyTask(task, now)
+	switch {
+	case urgency == UrgencyTentative:
+		return Dim // someday/maybe tasks are never urgent
+	case urgency == UrgencyOverdue:
+		return Red // highlight due/overdue tasks in red
+	case colorNames[task.color] != "":
+		return colorNames[task.color]
+	case urgency == UrgencyDone:
+		return Green // highlight done tasks in green
+	case task.done == "Doing":
+		return Yellow // highlight tasks in progress in yellow
+	case urgency == UrgencyToday:
+		return Blue // highlight tasks due today in blue
+	}
+	return ""
+}
+
+// FormatRow returns a task as a row of the given columns, in color if color isn't ""
+func FormatRow(columns []Column, i int, task Task, color string) string {
+	due := FormatDue(task.due)
+	if isUndated(task.due) {
+		due = ""
+	}
+	row := ""
+	for _, c := range columns {
+		text := ""
+		switch c.name {
+		case "ID":
+			text = strconv.Itoa(i)
+		case "Title":
+			text = task.title
+		case "Due":
+			text = due
+		case "Prty":
+			text = " " + task.priority
+		case "Repeat":
+			text = task.repeat
+		case "Label":
+			text = task.label
+		case "Done":
+			text = DoneMarker(task.done)
+		}
+		row += colorize(truncate(text, c.width-1), color, c.width) // leave a space between columns
+	}
+	if done, total := SubtaskProgress(task); total > 0 {
+		row += fmt.Sprintf("%d/%d done", done, total)
+	}
+	return row
+}
+
+// RenderTasksText returns the tasks at ids as plain text, with their IDs
+func RenderTasksText(tasks []Task, ids []int) string {
+	text := FormatHeader(allColumns)
+	for _, i := range ids {
+		text += strings.TrimRight(FormatRow(allColumns, i, tasks[i], ""), " ") + "\n"
+	}
+	return text
+}
+
+// CopyTasks copies the current view of the list to the clipboard, or prints it
+// if there is no clipboard tool
+func CopyTasks(filterBy string, query Query) {
+	text := RenderTasksText(taskList, ViewIDs(taskList, filterBy, query, now()))
+	if err := CopyToClipboard(text); err != nil {
+		fmt.Print("\nCould not copy to the clipboard, here is the list to copy by hand:\n\n")
+		fmt.Print(text)
+	} else {
+		fmt.Println("Task list copied to the clipboard.")
+	}
+	pause()
+}
+
+// clipboardCommand returns the command that copies stdin to the clipboard on this OS, or nil if none is found
+var clipboardCommand = func() *exec.Cmd {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("pbcopy")
+	case "windows":
+		return exec.Command("clip.exe")
+	}
+	for _, args := range [][]string{{"wl-copy"}, {"xclip", "-selection", "clipboard"}, {"xsel", "--clipboard", "--input"}} {
+		if _, err := exec.LookPath(args[0]); err == nil {
+			return exec.Command(args[0], args[1:]...)
+		}
+	}
+	return nil
+}
+
+// CopyToClipboard puts text on the system clipboard
+func CopyToClipboard(text string) error {
+	cmd := clipboardCommand()
+	if cmd == nil {
+		return errors.New("no clipboard tool found")
+	}
+	cmd.Stdin = strings.NewReader(text)
+	return cmd.Run()
+}
+
+// truncate shortens text to at most width characters
+func truncate(text string, width int) string {
+	runes := []rune(text)
+	if len(runes) <= width {
+		return text
+	}
+	return string(runes[:max(width, 0)])
+}
+
+// colorize pads text to width and then wraps it in the color code, so the
+// invisible ANSI bytes don't count towards the column width
+func colorize(text string, color string, width int) string {
+	text = fmt.Sprintf("%-*s", width, text)
+	if color == "" || !useColor() {
+		return text
+	}
+	return color + text + Reset
+}
+
+// useColor reports whether colored output is wanted (see https://no-color.org)
+func useColor() bool {
+	return os.Getenv("NO_COLOR") == ""
+}
+
+// SearchTasks lists tasks whose title, label or notes contain the search text,
+// showing the part of the notes that matched
+func SearchTasks() {
+	query := inputStr("Search for: ", 30)
+	if query == "" {
+		return
+	}
+	lower := strings.ToLower(query)
+	fmt.Print("\033[H\033[2J") // clear the terminal screen
+	PrintTitleHeader()
+	found := 0
+	for i, task := range taskList {
+		inNotes := strings.Contains(strings.ToLower(task.notes), lower)
+		if !inNotes && !strings.Contains(strings.ToLower(task.title), lower) &&
+			!strings.Contains(strings.ToLower(task.label), lower) {
+			continue
+		}
+		PrintTask(i, task)
+		if inNotes {
+			fmt.Println("   " + NoteSnippet(task.notes, query, 20))
+		}
+		found++
+	}
+	fmt.Printf("\n%d tasks found.\n", found)
+	pause()
+}
+
+// NoteSnippet returns the part of notes around the first match of query,
+// with up to radius characters either side and the match highlighted
+func NoteSnippet(notes string, query string, radius int) string {
+	runes := []rune(notes)
+	lower := []rune(strings.ToLower(notes))
+	q := []rune(strings.ToLower(query))
+	start := -1
+	for i := 0; i+len(q) <= len(lower); i++ {
+		if string(lower[i:i+len(q)]) == string(q) {
+			start = i
+			break
+		}
+	}
+	if start < 0 || len(lower) != len(runes) { // no match, or lowercasing changed the length
+		return notes
+	}
+	end := start + len(q)
+
+	from, to := max(start-radius, 0), min(end+radius, len(runes))
+	prefix, suffix := "", ""
+	if from > 0 {
+		prefix = "..."
+	}
+	if to < len(runes) {
+		suffix = "..."
+	}
+	match := "**" + string(runes[start:end]) + "**"
+	if useColor() {
+		match = Yellow + string(runes[start:end]) + Reset
+	}
+	return prefix + string(runes[from:start]) + match + string(runes[end:to]) + suffix
+}
+
+// RemoveTask removes a task from taskList by ID
+func RemoveTask() string {
+	if len(taskList) == 0 {
+		return "No tasks to delete!"
+	}
+	id, ok := inputInt("Enter task ID to delete: ", 0, len(taskList)-1)
+	if !ok {
+		return "Invalid task ID!"
+	}
+	return RemoveTaskID(id)
+}
+
+// RemoveTaskID removes the task at id from taskList
+func RemoveTaskID(id int) string {
+	WriteAudit("remove", taskList[id].title)
+	taskList = removeTaskAt(taskList, id)
+	return "Task deleted."
+}
+
+// removeTaskAt returns a new slice without the task at index id. The original
+// backing array is left untouched, so any snapshot or sub-slice still holding it
+// keeps its tasks; once nothing refers to it, the whole array is garbage collected.
+func removeTaskAt(list []Task, id int) []Task {
+	if len(list) == 1 {
+		return nil
+	}
+	return slices.Concat(list[:id], list[id+1:])
+}
+
+// DueTasks lists tasks that are due soon, most urgent first
+func DueTasks() { // tasks due soon
+	soon := DueSoon(taskList, now())
+	if len(soon) == 0 {
+		return
+	}
+	fmt.Println("\n-- Tasks Due soon ----")
+	for _, task := range soon {
+		due := RelativeDate(task.due, now(), currentLocale())
+		fmt.Printf("%s (%s), ", task.title, due)
+	}
+	fmt.Println()
+}
+
+// DueSoon returns the not-done tasks due within dueSoonDays of now, ordered by urgency
+func DueSoon(tasks []Task, now time.Time) []Task {
+	today := startOfDay(now)
+	var soon []Task
+	for _, task := range tasks {
+		if urgency := ClassifyTask(task, now); urgency == UrgencyToday || urgency == UrgencySoon {
+			soon = append(soon, task)
+		}
+	}
+	slices.SortStableFunc(soon, func(x, y Task) int {
+		return cmp.Compare(UrgencyScore(x, today), UrgencyScore(y, today))
+	})
+	return soon
+}
+
+// UrgencyScore combines days until due and priority, lower is more urgent.
+// Each priority step counts as two days, so a priority 1 task due in 3 days
+// comes before a priority 3 task due tomorrow.
+func UrgencyScore(task Task, today time.Time) int {
+	priority, err := strconv.Atoi(task.priority)
+	if err != nil {
+		priority = 3
+	}
+	return daysBetween(today, task.due) + 2*(priority-1)
+}
+
+// SortTasksByDueDate sorts taskList by due date
+func SortTasksByDueDate() {
+	sortFunc := func(x, y Task) int {
+		return x.due.Compare(y.due)
+	}
+	taskList = slices.SortedStableFunc(slices.Values(taskList), sortFunc)
+	PartitionDone()
+}
+
+// SortTasksByPriority sorts taskList by priority
+func SortTasksByPriority() {
+	sortFunc := func(x, y Task) int {
+		return cmp.Compare(x.priority, y.priority)
+	}
+	taskList = slices.SortedStableFunc(slices.Values(taskList), sortFunc)
+	PartitionDone()
+}
+
+// SortTasksByName sorts taskList by name
+func SortTasksByName() {
+	sortFunc := func(x, y Task) int {
+		return cmp.Compare(x.title, y.title)
+	}
+	taskList = slices.SortedStableFunc(slices.Values(taskList), sortFunc)
+	PartitionDone()
+}
+
+// PartitionDone moves done tasks below not-done tasks if config.doneLast is set,
+// keeping the existing order within each group. Recurring tasks count as not done,
+// since they will be reset to their next occurrence.
+func PartitionDone() {
+	if !config.doneLast {
+		return
+	}
+	isDone := func(task Task) int {
+		if task.done == "Yes" && task.repeat == "" {
+			return 1
+		}
+		return 0
+	}
+	slices.SortStableFunc(taskList, func(x, y Task) int {
+		return cmp.Compare(isDone(x), isDone(y))
+	})
+}
+
+// ToggleDoneLast switches sorting done tasks to the bottom on or off and saves the setting
+func ToggleDoneLast() {
+	config.doneLast = !config.doneLast
+	WriteConfig()
+	if config.doneLast {
+		fmt.Println("Done tasks will be sorted to the bottom.")
+	} else {
+		fmt.Println("Done tasks will be sorted with the rest.")
+	}
+	PartitionDone()
+	pause()
+}
+
+// SortTasks prompts user for sort option and sorts taskList accordingly
+func SortTasks() {
+	s := inputStr("Sort by (n)ame, (p)riority, (d)ue: ", 5)
+	switch strings.ToLower(s) {
+	case "n", "name":
+		config.sortBy = "name"
+	case "p", "priority":
+		config.sortBy = "priority"
+	case "d", "due":
+		config.sortBy = "due"
+	default:
+		fmt.Println("Invalid sort option!")
+		return
+	}
+	SortBy(config.sortBy)
+	WriteConfig() // remember the choice for next time
+}
+
+// SortBy sorts taskList by "name", "priority" or "due"
+func SortBy(key string) {
+	switch key {
+	case "name":
+		SortTasksByName()
+	case "priority":
+		SortTasksByPriority()
+	default:
+		SortTasksByDueDate()
+	}
+}
+
+// AutoSort re-applies the last chosen sort, if autoSort is on, so changes
+// appear in sorted position straight away
+func AutoSort() {
+	if config.autoSort {
+		SortBy(config.sortBy)
+	}
+}
+
+// ToggleAutoSort switches automatic re-sorting on or off and saves the setting
+func ToggleAutoSort() {
+	config.autoSort = !config.autoSort
+	WriteConfig()
+	if config.autoSort {
+		fmt.Println("The list will be re-sorted after every change.")
+	} else {
+		fmt.Println("New tasks will be added at the bottom of the list.")
+	}
+	pause()
+}
+
+// UpdateRecurringTasks updates recurring tasks that are marked as done
 func UpdateRecurringTasks() {
-	today := time.Now()
-	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, today.Location()) // set time to 00:00
+	today := Today()
 	for i, task := range taskList {
-		if task.done == "Yes" && task.repeat != "" {
-			if task.due.Before(today) || task.due.Equal(today) {
-				switch task.repeat {
-				case "Daily":
-					taskList[i].due = task.due.AddDate(0, 0, 1)
-				case "Weekly":
-					taskList[i].due = task.due.AddDate(0, 0, 7)
-				case "Monthly":
-					taskList[i].due = task.due.AddDate(0, 1, 0)
+		if task.done != "Yes" || task.repeat == "" {
+			continue
+		}
+		if task.repeatFromDone && !task.completed.IsZero() {
+			// advance from the day it was actually done, not the day it was scheduled
+			// keeping any time of day the task was due at
+			done := time.Date(task.completed.Year(), task.completed.Month(), task.completed.Day(),
+				task.due.Hour(), task.due.Minute(), 0, 0, time.Local)
+			taskList[i].due = advanceDue(done, task.repeat)
+			taskList[i].done = "No" // mark as not done
+		} else if !startOfDay(task.due).After(today) {
+			taskList[i].due = advanceDue(task.due, task.repeat)
+			taskList[i].done = "No" // mark as not done
+		} else {
+			continue
+		}
+		touch(&taskList[i])
+		WriteAudit("edit", task.title)
+	}
+}
+
+type RecurringIssue struct { // a recurring task in a state UpdateRecurringTasks can't sort out
+	id      int
+	problem string
+	fix     string
+}
+
+// CheckRecurring finds recurring tasks with a repeat that can't be read, no due date to repeat from,
+// or that are done but won't reset until a future due date
+func CheckRecurring(tasks []Task, now time.Time) []RecurringIssue {
+	var issues []RecurringIssue
+	for i, task := range tasks {
+		if task.repeat == "" {
+			continue
+		}
+		if _, _, _, ok := RepeatInterval(task.repeat); !ok {
+			issues = append(issues, RecurringIssue{i, fmt.Sprintf("repeat %q is not recognized", task.repeat),
+				"edit the repeat to daily, weekly, monthly or eg. P2W"})
+			continue
+		}
+		if isUndated(task.due) {
+			issues = append(issues, RecurringIssue{i, "repeats but has no due date",
+				"give it a due date, or remove the repeat"})
+			continue
+		}
+		if task.done == "Yes" && !task.repeatFromDone && startOfDay(task.due).After(startOfDay(now)) {
+			issues = append(issues, RecurringIssue{i, "is done but won't reset until " + FormatDue(task.due),
+				"mark it not done, or set it to repeat from completion"})
+		}
+	}
+	return issues
+}
+
+// PrintRecurringHealth reports recurring tasks that are stuck, with a suggested fix for each
+func PrintRecurringHealth() {
+	issues := CheckRecurring(taskList, now())
+	if len(issues) == 0 {
+		fmt.Println("All recurring tasks look healthy!")
+		pause()
+		return
+	}
+	fmt.Println("\n----- Recurring task problems -----")
+	for _, issue := range issues {
+		fmt.Printf("%d %s: %s\n   Fix: %s\n", issue.id, taskList[issue.id].title, issue.problem, issue.fix)
+	}
+	pause()
+}
+
+// advanceDue returns the next due date after due for the given repeat interval
+func advanceDue(due time.Time, repeat string) time.Time {
+	years, months, days, ok := RepeatInterval(repeat)
+	if !ok {
+		return due
+	}
+	return due.AddDate(years, months, days)
+}
+
+// DoneTask marks a task as done by ID
+func DoneTask() string {
+	if len(taskList) == 0 {
+		fmt.Println("No tasks to mark as done!")
+		return ""
+	}
+	id, ok := inputInt("Enter task ID to mark as done: ", 0, len(taskList)-1)
+	if !ok {
+		fmt.Println("Invalid task ID!")
+		return ""
+	}
+	return DoneTaskID(id)
+}
+
+// DoneTaskID marks the task at id done, returning a confirmation, or "" if cancelled
+func DoneTaskID(id int) string {
+	task := &taskList[id]
+	if task.repeat != "" && config.confirmRepeat && !ConfirmRecurringDone(task) {
+		return ""
+	}
+	setDone(task, "Yes")
+	WriteAudit("done", task.title)
+	return DoneMessage(*task)
+}
+
+// DoneMessage confirms a task was done, with the current streak if it repeats
+func DoneMessage(task Task) string {
+	message := colorize("✓ Done: "+task.title, Green, 0)
+	if task.repeat == "" {
+		return message
+	}
+	dates, err := AuditDates(auditPath(), "done", task.title)
+	if err != nil {
+		return message
+	}
+	if streak := Streak(dates, task.repeat); streak > 1 {
+		message += fmt.Sprintf(" (streak: %d in a row)", streak)
+	}
+	return message
+}
+
+// AuditDates returns when action was logged in the audit log for the task with this title
+func AuditDates(path string, action string, taskTitle string) ([]time.Time, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var dates []time.Time
+	for _, row := range rows {
+		if len(row) < 3 || row[1] != action || !strings.EqualFold(row[2], taskTitle) {
+			continue
+		}
+		if at, err := time.ParseInLocation("2006-01-02 15:04:05", row[0], time.Local); err == nil {
+			dates = append(dates, at)
+		}
+	}
+	return dates, nil
+}
+
+// Streak counts how many times in a row a recurring task was done, going back from the latest
+// completion. It breaks where the next completion came after the following occurrence was due,
+// meaning an occurrence was missed. Several completions on one day count once.
+func Streak(dates []time.Time, repeat string) int {
+	if len(dates) == 0 {
+		return 0
+	}
+	days := make([]time.Time, len(dates))
+	for i, date := range dates {
+		days[i] = startOfDay(date)
+	}
+	slices.SortFunc(days, func(a, b time.Time) int { return b.Compare(a) }) // latest first
+	days = slices.CompactFunc(days, time.Time.Equal)
+	streak := 1
+	for i := 1; i < len(days); i++ {
+		if days[i-1].After(advanceDue(days[i], repeat)) {
+			break // missed the occurrence after days[i]
+		}
+		streak++
+	}
+	return streak
+}
+
+// ConfirmRecurringDone explains that a recurring task will reset rather than finish, and
+// offers to stop it repeating instead. Returns false if the user cancels.
+func ConfirmRecurringDone(task *Task) bool {
+	fmt.Printf("'%s' repeats %s, so marking it done resets it to the next occurrence.\n",
+		task.title, strings.ToLower(task.repeat))
+	switch strings.ToLower(inputStr("(r)eset to next occurrence, (s)top repeating, Enter cancels: ", 5)) {
+	case "r", "reset":
+		return true
+	case "s", "stop":
+		task.repeat = ""
+		task.repeatFromDone = false
+		return true
+	}
+	return false
+}
+
+var csvHeader = []string{"Title", "Due", "Priority", "Repeat", "Label", "Done", "Notes", "Completed", "Repeat From", "Subtasks", "Color", "Hidden Until", "Estimate", "Tentative"}
+
+// ExportCSV writes taskList to a spreadsheet-friendly CSV file with a header row.
+// This is separate from the data file format; undated tasks have a blank Due.
+func ExportCSV(path string, tasks []Task) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		due := FormatDue(task.due)
+		if isUndated(task.due) {
+			due = ""
+		}
+		completed := ""
+		if !task.completed.IsZero() {
+			completed = task.completed.Format("2006-01-02 15:04")
+		}
+		repeatFrom := ""
+		if task.repeat != "" {
+			repeatFrom = "Due"
+			if task.repeatFromDone {
+				repeatFrom = "Completed"
+			}
+		}
+		row := []string{task.title, due, task.priority, task.repeat, task.label, task.done, task.notes,
+			completed, repeatFrom, EncodeSubtasks(task.subtasks), task.color, task.hiddenUntil, FormatEstimate(task.estimate),
+			yesNo(task.tentative)}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// ImportCSV reads tasks from a CSV file with a header row, as written by ExportCSV.
+// Columns are matched by header name, so they may be in any order or missing.
+func ImportCSV(path string) ([]Task, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1 // allow short rows
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	columns := map[string]int{}
+	for i, name := range rows[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	field := func(row []string, name string) string {
+		i, ok := columns[strings.ToLower(name)]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+
+	var tasks []Task
+	for _, row := range rows[1:] {
+		task := Task{
+			title:    field(row, "Title"),
+			priority: field(row, "Priority"),
+			repeat:   field(row, "Repeat"),
+			label:    field(row, "Label"),
+			done:     field(row, "Done"),
+			notes:    field(row, "Notes"),
+		}
+		if task.title == "" {
+			continue
+		}
+		due, err := ParseDue(field(row, "Due"))
+		if err != nil {
+			due = noDueDate
+		}
+		task.due = due
+		if task.priority, err = ParsePriority(task.priority); err != nil {
+			task.priority = "3" // default priority
+		}
+		if task.done != "Yes" && task.done != "Doing" {
+			task.done = "No"
+		}
+		task.completed, _ = time.ParseInLocation("2006-01-02 15:04", field(row, "Completed"), time.Local)
+		task.repeatFromDone = task.repeat != "" && field(row, "Repeat From") == "Completed"
+		task.subtasks = DecodeSubtasks(field(row, "Subtasks"))
+		task.color = strings.ToLower(field(row, "Color"))
+		task.hiddenUntil = field(row, "Hidden Until")
+		task.estimate, _ = ParseEstimate(field(row, "Estimate"))
+		task.tentative = field(row, "Tentative") == "Yes"
+		for name := range columns {
+			task.given = append(task.given, name)
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+// ExportTasks prompts for a file name and exports taskList as CSV
+func ExportTasks() {
+	path := inputStr("Export to CSV file: ", 150)
+	if path == "" {
+		return
+	}
+	if err := ExportCSV(path, taskList); err != nil {
+		fmt.Println("Error writing to file!")
+	} else {
+		fmt.Println("Tasks exported to:", path)
+	}
+	pause()
+}
+
+// ExportJSON writes tasks as a JSON array of objects with the fields ImportJSON reads
+func ExportJSON(path string, tasks []Task) error {
+	records := []map[string]string{}
+	for _, task := range tasks {
+		due := FormatDue(task.due)
+		if isUndated(task.due) {
+			due = ""
+		}
+		records = append(records, map[string]string{"title": task.title, "due": due, "priority": task.priority,
+			"repeat": task.repeat, "label": task.label, "done": task.done, "notes": task.notes})
+	}
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// ExportSnapshot reads the data file at dataPath afresh and writes its tasks to outPath as
+// "csv", "json" or "text". It doesn't use or change taskList, so it is safe to run as a separate
+// command, eg. from cron, while TaskManGo is open elsewhere.
+func ExportSnapshot(dataPath string, outPath string, format string) error {
+	tasks, err := LoadTasks(dataPath)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "csv":
+		return ExportCSV(outPath, tasks)
+	case "json":
+		return ExportJSON(outPath, tasks)
+	case "text":
+		ids := make([]int, len(tasks)) // every task, including hidden ones
+		for i := range ids {
+			ids[i] = i
+		}
+		return os.WriteFile(outPath, []byte(RenderTasksText(tasks, ids)), 0644)
+	}
+	return fmt.Errorf("unknown format %q, use csv, json or text", format)
+}
+
+// RunExport exports the data file from the command line, eg. "export tasks.json" or
+// "export tasks.txt --format text", the format otherwise coming from the file extension.
+// The data file is the one in the config unless given with --data; nothing is asked for.
+// Returns the exit code.
+func RunExport(args []string) int {
+	var files []string
+	format, data := "", ""
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--format" && i+1 < len(args) {
+			i++
+			format = strings.ToLower(args[i])
+		} else if args[i] == "--data" && i+1 < len(args) {
+			i++
+			data = args[i]
+		} else {
+			files = append(files, args[i])
+		}
+	}
+	if len(files) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: export file [--format csv|json|text] [--data file]")
+		return 2
+	}
+	if data == "" {
+		if !LoadConfig() {
+			fmt.Fprintln(os.Stderr, "export: no config file, give the data file with --data file")
+			return 2
+		}
+		data = config.filePath
+	}
+	out := files[0]
+	if format == "" {
+		format = "csv"
+		switch strings.ToLower(filepath.Ext(out)) {
+		case ".json":
+			format = "json"
+		case ".txt":
+			format = "text"
+		}
+	}
+	if err := ExportSnapshot(data, out, format); err != nil {
+		fmt.Fprintln(os.Stderr, "export:", err)
+		return 1
+	}
+	fmt.Println("Tasks exported to:", out)
+	return 0
+}
+
+// ImportTasks prompts for a CSV or JSON file and how to combine its tasks with taskList
+func ImportTasks() {
+	path := inputStr("Import from CSV or JSON file: ", 150)
+	if path == "" {
+		return
+	}
+	var tasks []Task
+	var err error
+	if strings.HasSuffix(strings.ToLower(path), ".json") {
+		var problems []string
+		tasks, problems, err = ImportJSON(path, config.strictImport)
+		for _, problem := range problems {
+			fmt.Println(problem)
+		}
+	} else {
+		tasks, err = ImportCSV(path)
+	}
+	if err != nil {
+		fmt.Println("Error reading file:", err)
+		pause()
+		return
+	}
+	mode := "append"
+	switch strings.ToLower(inputStr("(a)ppend, (r)eplace all, or (m)erge by title? ", 10)) {
+	case "r", "replace":
+		if yesNoInput(fmt.Sprintf("Replace all %d tasks with the %d imported?", len(taskList), len(tasks))) != "Yes" {
+			return
+		}
+		mode = "replace"
+	case "m", "merge":
+		mode = "merge"
+	}
+	var report string
+	taskList, report = MergeImported(taskList, tasks, mode)
+	fmt.Println(report)
+	pause()
+}
+
+// ImportJSON reads tasks from a JSON array of objects with the fields title, due, priority, repeat,
+// label, done and notes. Each record is checked by ValidateJSONTask; the problems found are returned
+// as messages, one per record, alongside the tasks that were accepted.
+func ImportJSON(path string, strict bool) ([]Task, []string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var records []map[string]any
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, nil, err
+	}
+	var tasks []Task
+	var problems []string
+	for i, record := range records {
+		task, errs, ok := ValidateJSONTask(record, strict)
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("Record %d rejected: %s", i+1, strings.Join(errs, "; ")))
+			continue
+		case len(errs) > 0:
+			problems = append(problems, fmt.Sprintf("Record %d repaired: %s", i+1, strings.Join(errs, "; ")))
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, problems, nil
+}
+
+// ValidateJSONTask checks one imported record: title must be a non-empty string, priority 1 to 3 or a name,
+// done Yes, No or Doing, due a date or empty, and repeat one TaskManGo understands. Bad values are
+// repaired to the defaults, unless strict, when the record is rejected. Without a title it
+// is always rejected. Returns the task, what was wrong, and whether it can be used.
+func ValidateJSONTask(record map[string]any, strict bool) (Task, []string, bool) {
+	var errs []string
+	text := func(name string) string { // a string field, "" if missing or not a string
+		switch v := record[name].(type) {
+		case nil:
+			return ""
+		case string:
+			return strings.TrimSpace(v)
+		case float64: // allow numbers, eg. priority 2
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		case bool: // allow true/false for done
+			return yesNo(v)
+		}
+		errs = append(errs, name+" is not text")
+		return ""
+	}
+
+	task := Task{
+		title:    text("title"),
+		priority: text("priority"),
+		label:    text("label"),
+		done:     text("done"),
+		notes:    text("notes"),
+		due:      noDueDate,
+	}
+	if task.title == "" {
+		return Task{}, append(errs, "title is missing"), false
+	}
+	if task.priority == "" {
+		task.priority = "3"
+	} else if priority, err := ParsePriority(task.priority); err == nil {
+		task.priority = priority
+	} else {
+		errs = append(errs, fmt.Sprintf("priority %q is not 1, 2 or 3", task.priority))
+		task.priority = "3"
+	}
+	switch strings.ToLower(task.done) {
+	case "", "no":
+		task.done = "No"
+	case "yes":
+		task.done = "Yes"
+	case "doing":
+		task.done = "Doing"
+	default:
+		errs = append(errs, fmt.Sprintf("done %q is not Yes, No or Doing", task.done))
+		task.done = "No"
+	}
+	if due := text("due"); due != "" {
+		if parsed, err := ParseDue(due); err == nil {
+			task.due = parsed
+		} else {
+			errs = append(errs, fmt.Sprintf("due %q is not a date", due))
+		}
+	}
+	if repeat := text("repeat"); repeat != "" {
+		parsed, err := ParseRepeat(repeat)
+		if err != nil || parsed == "" {
+			errs = append(errs, fmt.Sprintf("repeat %q is not recognized", repeat))
+		}
+		task.repeat = parsed
+	}
+	if strict && len(errs) > 0 {
+		return Task{}, errs, false
+	}
+	for _, name := range []string{"title", "due", "priority", "repeat", "label", "done", "notes"} {
+		repaired := slices.ContainsFunc(errs, func(e string) bool { return strings.HasPrefix(e, name+" ") })
+		if record[name] != nil && !repaired { // a repaired default shouldn't overwrite a merged task's value
+			task.given = append(task.given, name)
+		}
+	}
+	return task, errs, true
+}
+
+// MergeImported combines imported tasks with list: "append" adds them all, "replace"
+// discards list, and "merge" updates tasks with matching titles using OverlayImported and adds the rest.
+// Added tasks are stamped as created and modified now. Returns the new list and a description of what was done.
+func MergeImported(list []Task, imported []Task, mode string) ([]Task, string) {
+	imported = slices.Clone(imported)
+	for i := range imported { // stamped so MergeTaskLists can tell the imported tasks apart later
+		imported[i].created = now()
+		touch(&imported[i])
+	}
+	switch mode {
+	case "replace":
+		for _, task := range list {
+			WriteAudit("remove", task.title)
+		}
+		for _, task := range imported {
+			WriteAudit("add", task.title)
+		}
+		return slices.Clone(imported), fmt.Sprintf("Replaced the list with %d imported tasks.", len(imported))
+	case "merge":
+		result := slices.Clone(list)
+		updated, added := 0, 0
+		for _, task := range imported {
+			i := slices.IndexFunc(result, func(t Task) bool { return strings.EqualFold(t.title, task.title) })
+			if i >= 0 {
+				result[i] = OverlayImported(result[i], task)
+				WriteAudit("edit", result[i].title)
+				updated++
+			} else {
+				result = append(result, task)
+				WriteAudit("add", task.title)
+				added++
+			}
+		}
+		return result, fmt.Sprintf("Updated %d tasks and added %d.", updated, added)
+	}
+	for _, task := range imported {
+		WriteAudit("add", task.title)
+	}
+	return slices.Concat(list, imported), fmt.Sprintf("Imported %d tasks.", len(imported))
+}
+
+// OverlayImported returns existing updated with the fields an import file gave for task,
+// keeping the rest, such as when it was created, its subtasks and its comments
+func OverlayImported(existing Task, task Task) Task {
+	for _, name := range task.given {
+		switch name {
+		case "title":
+			existing.title = task.title
+		case "due":
+			existing.due, existing.badDue = task.due, ""
+		case "priority":
+			existing.priority = task.priority
+		case "repeat":
+			existing.repeat = task.repeat
+		case "repeat from":
+			existing.repeatFromDone = task.repeatFromDone
+		case "label":
+			existing.label = task.label
+		case "done":
+			setDone(&existing, task.done)
+		case "notes":
+			existing.notes = task.notes
+		case "subtasks":
+			existing.subtasks = task.subtasks
+		case "color":
+			existing.color = task.color
+		case "hidden until":
+			existing.hiddenUntil = task.hiddenUntil
+		case "estimate":
+			existing.estimate = task.estimate
+		case "tentative":
+			existing.tentative = task.tentative
+		}
+	}
+	if slices.Contains(task.given, "completed") && !task.completed.IsZero() {
+		existing.completed = task.completed // after done, which stamps it with now
+	}
+	touch(&existing)
+	return existing
+}
+
+// auditPath returns the path of the append-only log of changes to tasks
+func auditPath() string {
+	return filepath.Join(config.folderPath, "TaskManGo-audit.log")
+}
+
+// WriteAudit appends a timestamped line recording an action (add, edit, done or remove) on a task
+func WriteAudit(action string, taskTitle string) {
+	if err := AppendAudit(auditPath(), now(), action, taskTitle); err != nil {
+		fmt.Println("Error writing audit log!")
+	}
+}
+
+// AppendAudit adds one CSV line, "time,action,title", to the audit log at path
+func AppendAudit(path string, at time.Time, action string, taskTitle string) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{at.Format("2006-01-02 15:04:05"), action, taskTitle})
+	writer.Flush()
+	return writer.Error()
+}
+
+// TailAudit returns the last n lines of the audit log, oldest first
+func TailAudit(path string, n int) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines, nil
+}
+
+// PrintAudit shows the most recent entries in the audit log
+func PrintAudit() {
+	n, err := strconv.Atoi(inputStr("How many entries (Enter for 10)? ", 4))
+	if err != nil || n < 1 {
+		n = 10
+	}
+	lines, err := TailAudit(auditPath(), n)
+	if os.IsNotExist(err) {
+		fmt.Println("Nothing has been logged yet!")
+	} else if err != nil {
+		fmt.Println("Error reading audit log!")
+	} else {
+		fmt.Println("\n----- Audit log -----")
+		for _, line := range lines {
+			fmt.Println(line)
+		}
+	}
+	pause()
+}
+
+// snapshotPath returns the path of the file recording the list as it was last saved
+func snapshotPath() string {
+	return filepath.Join(config.folderPath, "TaskManGo-snapshot.txt")
+}
+
+type SnapshotEntry struct { // a task as it was when last saved
+	title string
+	due   time.Time
+	done  string
+}
+
+// SaveSnapshot records the title, due date and done status of every task, and when they were saved
+func SaveSnapshot(path string, tasks []Task, at time.Time) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{at.Format("2006-01-02 15:04")})
+	for _, task := range tasks {
+		writer.Write([]string{task.title, FormatDue(task.due), task.done})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// LoadSnapshot reads a snapshot written by SaveSnapshot
+func LoadSnapshot(path string) ([]SnapshotEntry, time.Time, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil || len(rows) == 0 {
+		return nil, time.Time{}, err
+	}
+	at, _ := time.ParseInLocation("2006-01-02 15:04", rows[0][0], time.Local)
+	var entries []SnapshotEntry
+	for _, row := range rows[1:] {
+		if len(row) < 3 {
+			continue
+		}
+		due, _ := ParseDue(row[1])
+		entries = append(entries, SnapshotEntry{title: row[0], due: due, done: row[2]})
+	}
+	return entries, at, nil
+}
+
+type ChangeReport struct { // titles of tasks that changed since the last snapshot
+	overdue, completed, added []string
+}
+
+// DiffSnapshot compares tasks now with a snapshot taken at prevAt, matching tasks by title
+func DiffSnapshot(prev []SnapshotEntry, prevAt time.Time, tasks []Task, now time.Time) ChangeReport {
+	byTitle := map[string]SnapshotEntry{}
+	for _, entry := range prev {
+		byTitle[entry.title] = entry
+	}
+	var report ChangeReport
+	for _, task := range tasks {
+		before, ok := byTitle[task.title]
+		switch {
+		case !ok:
+			report.added = append(report.added, task.title)
+		case task.done == "Yes" && before.done != "Yes":
+			report.completed = append(report.completed, task.title)
+		case ClassifyTask(task, now) == UrgencyOverdue && (before.done == "Yes" || !IsOverdue(before.due, prevAt)):
+			report.overdue = append(report.overdue, task.title)
+		}
+	}
+	return report
+}
+
+// PrintChanges reports tasks that became overdue, were completed or were added since the last save
+func PrintChanges() {
+	prev, prevAt, err := LoadSnapshot(snapshotPath())
+	if err != nil || prevAt.IsZero() {
+		return // first run, nothing to compare with
+	}
+	report := DiffSnapshot(prev, prevAt, taskList, now())
+	if len(report.overdue)+len(report.completed)+len(report.added) == 0 {
+		return
+	}
+	fmt.Println("\n----- Since", prevAt.Format("2006-01-02 15:04"), "-----")
+	for _, change := range []struct {
+		heading string
+		titles  []string
+	}{{"Now overdue", report.overdue}, {"Completed", report.completed}, {"Added", report.added}} {
+		if len(change.titles) > 0 {
+			fmt.Printf("%s: %s\n", change.heading, strings.Join(change.titles, ", "))
+		}
+	}
+	pause()
+}
+
+// templatesPath returns the path of the file holding task templates
+func templatesPath() string {
+	return filepath.Join(config.folderPath, "TaskManGo-templates.txt")
+}
+
+// NewTemplate makes a template from a task, keeping what it is and how it repeats but not
+// its date or progress
+func NewTemplate(task Task) Task {
+	template := Task{
+		title:          task.title,
+		due:            noDueDate,
+		priority:       task.priority,
+		repeat:         task.repeat,
+		label:          task.label,
+		done:           "No",
+		notes:          task.notes,
+		repeatFromDone: task.repeatFromDone,
+		color:          task.color,
+		estimate:       task.estimate,
+	}
+	for _, sub := range task.subtasks {
+		template.subtasks = append(template.subtasks, Subtask{text: sub.text})
+	}
+	return template
+}
+
+// Instantiate makes a new task from a template, due on the given date
+func Instantiate(template Task, due time.Time) Task {
+	task := template
+	task.subtasks = slices.Clone(template.subtasks)
+	task.due = due
+	task.done = "No"
+	task.created, task.modified = now(), now()
+	return task
+}
+
+// SaveTemplate adds a template to the templates file, replacing one with the same title
+func SaveTemplate(template Task) error {
+	templates, err := LoadTasks(templatesPath())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	templates = slices.DeleteFunc(templates, func(t Task) bool { return strings.EqualFold(t.title, template.title) })
+	return SaveTasks(templatesPath(), append(templates, template))
+}
+
+// Templates saves tasks as templates, lists the templates, and adds tasks made from them
+func Templates() {
+	templates, err := LoadTasks(templatesPath())
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("Error reading templates file!")
+		pause()
+		return
+	}
+	switch strings.ToLower(inputStr("(n)ew template from a task, (l)ist templates, or (u)se one? ", 10)) {
+	case "n", "new":
+		if len(taskList) == 0 {
+			fmt.Println("No tasks to make a template from!")
+			pause()
+			return
+		}
+		id, ok := inputInt("Enter task ID to save as a template: ", 0, len(taskList)-1)
+		if !ok {
+			fmt.Println("Invalid task ID!")
+			return
+		}
+		if err := SaveTemplate(NewTemplate(taskList[id])); err != nil {
+			fmt.Println("Error writing templates file!")
+		} else {
+			fmt.Println("Saved template:", taskList[id].title)
+		}
+		pause()
+	case "l", "list", "u", "use":
+		if len(templates) == 0 {
+			fmt.Println("No templates saved yet!")
+			pause()
+			return
+		}
+		fmt.Println("\n----- Templates -----")
+		PrintTitleHeader()
+		for i, template := range templates {
+			PrintTask(i, template)
+		}
+		input := inputStr("\nTemplate ID to add to the list (Enter cancels): ", 4)
+		if input == "" {
+			return
+		}
+		id, err := strconv.Atoi(input)
+		if err != nil || id < 0 || id >= len(templates) {
+			fmt.Println("Invalid template ID!")
+			pause()
+			return
+		}
+		taskList = append(taskList, Instantiate(templates[id], inputDueDate()))
+		WriteAudit("add", taskList[len(taskList)-1].title)
+	}
+}
+
+// archivePath returns the path of the file holding archived tasks
+func archivePath() string {
+	return filepath.Join(config.folderPath, "TaskManGo-archive.txt")
+}
+
+// ArchiveDone moves done, non-recurring tasks from taskList to the archive file
+func ArchiveDone() {
+	var keep, done []Task
+	for _, task := range taskList {
+		if task.done == "Yes" && task.repeat == "" {
+			done = append(done, task)
+		} else {
+			keep = append(keep, task)
+		}
+	}
+	if len(done) == 0 {
+		fmt.Println("No done tasks to archive!")
+		pause()
+		return
+	}
+	if yesNoInput(fmt.Sprintf("Archive %d done tasks?", len(done))) != "Yes" {
+		return
+	}
+	if err := AppendToArchive(done); err != nil {
+		fmt.Println("Error writing archive file!")
+		pause()
+		return
+	}
+	for _, task := range done {
+		WriteAudit("remove", task.title)
+	}
+	taskList = keep
+}
+
+// AppendToArchive adds tasks to the end of the archive file
+func AppendToArchive(tasks []Task) error {
+	archive, err := LoadTasks(archivePath())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return SaveTasks(archivePath(), append(archive, tasks...))
+}
+
+// SplitAutoArchive separates non-recurring tasks completed more than days ago from the rest
+func SplitAutoArchive(tasks []Task, days int, now time.Time) (keep []Task, old []Task) {
+	cutoff := startOfDay(now).AddDate(0, 0, -days)
+	for _, task := range tasks {
+		if task.done == "Yes" && task.repeat == "" && !task.completed.IsZero() && task.completed.Before(cutoff) {
+			old = append(old, task)
+		} else {
+			keep = append(keep, task)
+		}
+	}
+	return keep, old
+}
+
+// AutoArchive moves tasks completed more than config.autoArchive days ago to the archive
+func AutoArchive() {
+	if config.autoArchive <= 0 {
+		return
+	}
+	keep, old := SplitAutoArchive(taskList, config.autoArchive, now())
+	if len(old) == 0 {
+		return
+	}
+	if err := AppendToArchive(old); err != nil {
+		fmt.Println("Error writing archive file!")
+		return
+	}
+	for _, task := range old {
+		WriteAudit("remove", task.title)
+	}
+	taskList = keep
+	fmt.Printf("Archived %d tasks done more than %d days ago.\n", len(old), config.autoArchive)
+	pause()
+}
+
+// RestoreFromArchive moves a task picked by ID or title search from the archive back into taskList
+func RestoreFromArchive() {
+	archive, err := LoadTasks(archivePath())
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("Error reading archive file!")
+		pause()
+		return
+	}
+	if len(archive) == 0 {
+		fmt.Println("The archive is empty!")
+		pause()
+		return
+	}
+
+	fmt.Println("\n----- Archived tasks -----")
+	PrintTitleHeader()
+	for i, task := range archive {
+		PrintTask(i, task)
+	}
+	id := findArchived(archive, inputStr("\nID or title to restore (Enter cancels): ", 30))
+	if id < 0 {
+		return
+	}
+
+	task := archive[id]
+	if err := SaveTasks(archivePath(), removeTaskAt(archive, id)); err != nil {
+		fmt.Println("Error writing archive file!")
+		pause()
+		return
+	}
+	taskList = append(taskList, task)
+	WriteAudit("add", task.title)
+}
+
+// findArchived returns the index of the archived task matching an ID or
+// title search, or -1 if there isn't exactly one match
+func findArchived(archive []Task, search string) int {
+	if search == "" {
+		return -1
+	}
+	if id, err := strconv.Atoi(search); err == nil {
+		if id < 0 || id >= len(archive) {
+			fmt.Println("Invalid task ID!")
+			pause()
+			return -1
+		}
+		return id
+	}
+	found := -1
+	for i, task := range archive {
+		if strings.Contains(strings.ToLower(task.title), strings.ToLower(search)) {
+			if found >= 0 {
+				fmt.Println("More than one task matches, use the ID instead.")
+				pause()
+				return -1
+			}
+			found = i
+		}
+	}
+	if found < 0 {
+		fmt.Println("No archived task matches!")
+		pause()
+	}
+	return found
+}
+
+// Today returns the current date with the time set to 00:00
+func Today() time.Time {
+	return startOfDay(now())
+}
+
+// SetClockFromEnv fixes the reference date to TASKMANGO_TODAY (YYYY-MM-DD) if it is set,
+// so date logic can be tested or the list viewed as of another day
+func SetClockFromEnv() {
+	fixed, err := time.ParseInLocation("2006-01-02", os.Getenv("TASKMANGO_TODAY"), time.Local)
+	if err != nil {
+		return
+	}
+	now = func() time.Time {
+		t := time.Now()
+		return time.Date(fixed.Year(), fixed.Month(), fixed.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local)
+	}
+}
+
+// startOfDay returns t with the time set to 00:00
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+var noDueDate = time.Date(2099, 12, 31, 0, 0, 0, 0, time.Local) // placeholder for tasks without a due date
+
+// isUndated reports whether due is the 2099-12-31 "no due date" placeholder
+func isUndated(due time.Time) bool {
+	return due.Format("2006-01-02") == "2099-12-31"
+}
+
+// ParseDueInput parses a typed due date, which may also be a day name, or a day and month name,
+// in the configured locale
+func ParseDueInput(s string) (time.Time, error) {
+	if day, ok := ParseDayName(s, currentLocale(), now()); ok {
+		return day, nil
+	}
+	if day, ok := ParseMonthDate(s, currentLocale(), now()); ok {
+		return day, nil
+	}
+	return ParseDue(s)
+}
+
+// ParseDue parses a due date given as YYYY-MM-DD or YYYY-MM-DD HH:MM, in local time
+func ParseDue(s string) (time.Time, error) {
+	if due, err := time.ParseInLocation("2006-01-02 15:04", s, time.Local); err == nil {
+		return due, nil
+	}
+	return time.ParseInLocation("2006-01-02", s, time.Local)
+}
+
+// dueLayouts are the other ways a due date may be written in a hand-edited or imported file
+var dueLayouts = []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02T15:04", "2006/01/02",
+	"2006/01/02 15:04", "2006.01.02", "2 Jan 2006", "2 January 2006", "Jan 2 2006", "January 2 2006",
+	"Jan 2, 2006", "January 2, 2006"}
+
+// ParseLooseDue parses a due date in any of dueLayouts or RFC 3339, as well as the usual formats
+func ParseLooseDue(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if due, err := ParseDue(s); err == nil {
+		return due, nil
+	}
+	if due, err := time.Parse(time.RFC3339, s); err == nil {
+		return due.In(time.Local), nil
+	}
+	for _, layout := range dueLayouts {
+		if due, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return due, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised due date %q", s)
+}
+
+// FormatDue formats a due date, including the time of day only if one was set
+func FormatDue(due time.Time) string {
+	if hasTime(due) {
+		return due.Format("2006-01-02 15:04")
+	}
+	return due.Format("2006-01-02")
+}
+
+// hasTime reports whether a due date has a time of day, rather than being due at 00:00
+func hasTime(due time.Time) bool {
+	return due.Hour() != 0 || due.Minute() != 0
+}
+
+// IsOverdue reports whether due has passed. A task with a time of day is overdue
+// from that time; a date-only task is overdue from the start of the next day.
+// Either way it isn't overdue until config.overdueGrace more days have passed.
+func IsOverdue(due time.Time, now time.Time) bool {
+	cutoff := now.AddDate(0, 0, -config.overdueGrace)
+	if hasTime(due) {
+		return due.Before(cutoff)
+	}
+	return due.Before(startOfDay(cutoff))
+}
+
+type Urgency int // how pressing a task is, from ClassifyTask
+
+const (
+	UrgencyUndated   Urgency = iota // not done, with no due date
+	UrgencyOverdue                  // not done, and past its due date
+	UrgencyToday                    // not done, and due later today
+	UrgencySoon                     // not done, and due within dueSoonDays
+	UrgencyLater                    // not done, and due after that
+	UrgencyTentative                // not done, and someday/maybe, so never counted as due
+	UrgencyDone                     // done, whenever it was due
+)
+
+// ClassifyTask returns how pressing a task is. The list colors, the status line counts, the due
+// banner, the due soon line, the stats, the due histogram and the changes since the last run all use it,
+// so they always agree on what is overdue, due today or due soon.
+func ClassifyTask(task Task, now time.Time) Urgency {
+	switch {
+	case task.done == "Yes":
+		return UrgencyDone
+	case task.tentative:
+		return UrgencyTentative
+	case isUndated(task.due):
+		return UrgencyUndated
+	case IsOverdue(task.due, now):
+		return UrgencyOverdue
+	case IsDueToday(task.due, now):
+		return UrgencyToday
+	case !startOfDay(task.due).After(startOfDay(now).AddDate(0, 0, config.dueSoonDays)):
+		return UrgencySoon
+	}
+	return UrgencyLater
+}
+
+// IsDueToday reports whether due is later today
+func IsDueToday(due time.Time, now time.Time) bool {
+	return startOfDay(due).Equal(startOfDay(now)) && !IsOverdue(due, now)
+}
+
+// daysBetween returns the number of calendar days from a to b, ignoring time of day and DST
+func daysBetween(a, b time.Time) int {
+	a = time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+	b = time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+	return int(b.Sub(a).Hours() / 24)
+}
+
+type Locale struct { // names used when reading and showing dates; stored dates are always ISO
+	today    string
+	tomorrow string
+	weekdays [7]string // Sunday first, as time.Weekday
+	months   [12]string
+}
+
+var locales = map[string]Locale{
+	"en": {"today", "tomorrow",
+		[7]string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"},
+		[12]string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	"fr": {"aujourd'hui", "demain",
+		[7]string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+		[12]string{"janv", "févr", "mars", "avr", "mai", "juin", "juil", "août", "sept", "oct", "nov", "déc"}},
+	"de": {"heute", "morgen",
+		[7]string{"sonntag", "montag", "dienstag", "mittwoch", "donnerstag", "freitag", "samstag"},
+		[12]string{"jan", "feb", "mär", "apr", "mai", "jun", "jul", "aug", "sep", "okt", "nov", "dez"}},
+	"es": {"hoy", "mañana",
+		[7]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+		[12]string{"ene", "feb", "mar", "abr", "may", "jun", "jul", "ago", "sep", "oct", "nov", "dic"}},
+}
+
+// currentLocale returns the configured locale, English if unset
+func currentLocale() Locale {
+	if loc, ok := locales[config.locale]; ok {
+		return loc
+	}
+	return locales["en"]
+}
+
+// ParseDayName turns "today", "tomorrow" or a weekday name (or its first three letters)
+// into a date, using the locale's words. A weekday means its next occurrence after today.
+func ParseDayName(s string, loc Locale, now time.Time) (time.Time, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	today := startOfDay(now)
+	switch {
+	case s == "":
+		return time.Time{}, false
+	case s == loc.today:
+		return today, true
+	case s == loc.tomorrow:
+		return today.AddDate(0, 0, 1), true
+	}
+	for day, name := range loc.weekdays {
+		if s == name || (len([]rune(s)) >= 3 && strings.HasPrefix(name, s)) {
+			ahead := (day - int(today.Weekday()) + 7) % 7
+			if ahead == 0 {
+				ahead = 7
+			}
+			return today.AddDate(0, 0, ahead), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// ParseMonthDate turns a day and month name in either order, with an optional year, into a date,
+// eg. "3 mar", "mar 3" or "3 mars 2027". A month can be typed in full or as the locale's short
+// name. Without a year it means the next time that date comes round, which may be today.
+func ParseMonthDate(s string, loc Locale, now time.Time) (time.Time, bool) {
+	fields := strings.Fields(strings.ToLower(strings.ReplaceAll(s, ",", " ")))
+	if len(fields) != 2 && len(fields) != 3 {
+		return time.Time{}, false
+	}
+	day, err := strconv.Atoi(strings.TrimSuffix(fields[0], ".")) // German writes "3. März"
+	if err != nil {
+		fields[0], fields[1] = fields[1], fields[0]
+		day, err = strconv.Atoi(strings.TrimSuffix(fields[0], "."))
+	}
+	month := slices.IndexFunc(loc.months[:], func(name string) bool { return strings.HasPrefix(fields[1], name) })
+	if err != nil || month < 0 {
+		return time.Time{}, false
+	}
+	today := startOfDay(now)
+	year := today.Year()
+	if len(fields) == 3 {
+		if year, err = strconv.Atoi(fields[2]); err != nil {
+			return time.Time{}, false
+		}
+	}
+	date := time.Date(year, time.Month(month+1), day, 0, 0, 0, 0, time.Local)
+	if date.Day() != day { // eg. 31 feb
+		return time.Time{}, false
+	}
+	if len(fields) == 2 && date.Before(today) {
+		date = date.AddDate(1, 0, 0)
+	}
+	return date, true
+}
+
+// RelativeDate shows a due date as the locale's word for today or tomorrow, a weekday name
+// within the coming week, or day and month name further out, keeping any time of day.
+func RelativeDate(due time.Time, now time.Time, loc Locale) string {
+	if isUndated(due) {
+		return ""
+	}
+	var day string
+	switch days := daysBetween(startOfDay(now), startOfDay(due)); {
+	case days == 0:
+		day = loc.today
+	case days == 1:
+		day = loc.tomorrow
+	case days > 1 && days < 7:
+		day = loc.weekdays[due.Weekday()]
+	default:
+		day = fmt.Sprintf("%d %s", due.Day(), loc.months[due.Month()-1])
+		if due.Year() != now.Year() {
+			day += fmt.Sprintf(" %d", due.Year())
+		}
+	}
+	if hasTime(due) {
+		day += due.Format(" 15:04")
+	}
+	return day
+}
+
+// weekStart returns the start of the week containing t, on Monday or Sunday as set by config.weekStart
+func weekStart(t time.Time) time.Time {
+	first := time.Monday
+	if config.weekStart == "Sunday" {
+		first = time.Sunday
+	}
+	offset := (int(t.Weekday()) - int(first) + 7) % 7 // days since the start of the week
+	return startOfDay(t).AddDate(0, 0, -offset)
+}
+
+// DueBanner returns a highlighted line naming the not-done tasks due today or overdue, or "" if none
+func DueBanner(tasks []Task, now time.Time) string {
+	var overdue, today []string
+	for _, task := range tasks {
+		switch ClassifyTask(task, now) {
+		case UrgencyOverdue:
+			overdue = append(overdue, task.title)
+		case UrgencyToday:
+			today = append(today, task.title)
+		}
+	}
+	if len(overdue)+len(today) == 0 {
+		return ""
+	}
+	color := Yellow
+	if len(overdue) > 0 {
+		color = Red
+	}
+	banner := fmt.Sprintf("*** %d due today, %d overdue: %s ***", len(today), len(overdue),
+		strings.Join(slices.Concat(overdue, today), ", "))
+	return colorize(banner, color, 0)
+}
+
+// NotifyArgs returns the command line that shows a desktop notification on goos, or nil if there isn't one
+func NotifyArgs(goos string, message string) []string {
+	switch goos {
+	case "linux", "freebsd", "openbsd", "netbsd":
+		return []string{"notify-send", "TaskManGo", message}
+	case "darwin":
+		return []string{"osascript", "-e", fmt.Sprintf("display notification %q with title \"TaskManGo\"", message)}
+	case "windows":
+		return []string{"msg", "*", "TaskManGo: " + message}
+	}
+	return nil
+}
+
+var runNotify = func(args []string) error { return exec.Command(args[0], args[1:]...).Run() } // replaceable for testing
+
+// NotifyDue alerts the user on startup about tasks due today or overdue, as set by config.notify.
+// Returns the banner to show above the first prompt, or "" if off or nothing is due.
+func NotifyDue() string {
+	if config.notify == "Off" {
+		return ""
+	}
+	banner := DueBanner(taskList, now())
+	if banner == "" {
+		return ""
+	}
+	fmt.Print("\a") // terminal bell
+	if config.notify == "Desktop" {
+		counts := CountTasks(taskList, "", Query{}, now())
+		message := fmt.Sprintf("%d tasks due today, %d overdue", counts.today, counts.overdue)
+		if args := NotifyArgs(runtime.GOOS, message); args != nil {
+			runNotify(args) // best effort, the banner is shown anyway
+		}
+	}
+	return banner
+}
+
+// OldestOpen returns the indexes of up to n not-done tasks, oldest first by when they were created.
+// Tasks from before created dates were recorded are aged by their due date instead.
+func OldestOpen(tasks []Task, n int) []int {
+	age := func(task Task) time.Time {
+		if task.created.IsZero() {
+			return task.due
+		}
+		return task.created
+	}
+	var ids []int
+	for i, task := range tasks {
+		if task.done != "Yes" {
+			ids = append(ids, i)
+		}
+	}
+	slices.SortStableFunc(ids, func(a, b int) int { return age(tasks[a]).Compare(age(tasks[b])) })
+	return ids[:min(n, len(ids))]
+}
+
+// PrintOldest lists the tasks that have been open longest, to do, delegate or drop
+func PrintOldest() {
+	n, err := strconv.Atoi(inputStr("How many tasks (Enter for 5)? ", 4))
+	if err != nil || n < 1 {
+		n = 5
+	}
+	ids := OldestOpen(taskList, n)
+	if len(ids) == 0 {
+		fmt.Println("No open tasks!")
+		pause()
+		return
+	}
+	fmt.Println("\n----- Open longest -----")
+	PrintTitleHeader()
+	for _, i := range ids {
+		PrintTask(i, taskList[i])
+	}
+	pause()
+}
+
+// Stats summarises the whole task list: how many are open, overdue and due soon,
+// how many were done this week, and the estimated work left
+func Stats(tasks []Task, now time.Time) string {
+	counts := CountTasks(tasks, "", Query{}, now)
+	thisWeek, doneThisWeek := 0, 0
+	nextWeek := weekStart(now).AddDate(0, 0, 7)
+	for _, task := range tasks {
+		switch ClassifyTask(task, now) {
+		case UrgencyDone:
+			if !task.completed.IsZero() && !task.completed.Before(weekStart(now)) {
+				doneThisWeek++
+			}
+		case UrgencyToday, UrgencySoon, UrgencyLater:
+			if task.due.Before(nextWeek) {
+				thisWeek++
+			}
+		}
+	}
+	minutes, _ := TotalEstimate(tasks, ViewIDs(tasks, "", Query{}, now))
+	var b strings.Builder
+	fmt.Fprintln(&b, "\n----- Stats -----")
+	fmt.Fprintf(&b, "Tasks: %d (%d open, %d in progress, %d done)\n",
+		counts.total, counts.total-counts.done-counts.doing, counts.doing, counts.done)
+	fmt.Fprintf(&b, "Overdue: %d   Due today: %d   Due this week: %d\n", counts.overdue, counts.today, thisWeek)
+	fmt.Fprintf(&b, "Done this week: %d\n", doneThisWeek)
+	if minutes > 0 {
+		fmt.Fprintf(&b, "Estimated work left: %s\n", FormatEstimate(minutes))
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+type HistogramBucket struct {
+	label string
+	count int
+}
+
+// DueHistogram counts not-done tasks by due week for the next 8 weeks,
+// plus overdue, later and undated buckets. Tentative tasks aren't counted.
+func DueHistogram(tasks []Task, now time.Time) []HistogramBucket {
+	today := startOfDay(now)
+	thisWeek := weekStart(today)
+	buckets := []HistogramBucket{{label: "Overdue"}}
+	for w := range 8 {
+		// label with the ISO week holding most of the days, whichever day the week starts on
+		year, week := thisWeek.AddDate(0, 0, 7*w+3).ISOWeek()
+		buckets = append(buckets, HistogramBucket{label: fmt.Sprintf("%d-W%02d", year, week)})
+	}
+	buckets = append(buckets, HistogramBucket{label: "Later"}, HistogramBucket{label: "Undated"})
+
+	for _, task := range tasks {
+		switch ClassifyTask(task, now) {
+		case UrgencyDone, UrgencyTentative:
+			continue
+		case UrgencyUndated:
+			buckets[len(buckets)-1].count++
+		case UrgencyOverdue:
+			buckets[0].count++
+		default:
+			w := daysBetween(thisWeek, weekStart(task.due)) / 7
+			if w < 8 {
+				buckets[w+1].count++
+			} else {
+				buckets[len(buckets)-2].count++
+			}
+		}
+	}
+	return buckets
+}
+
+// PrintDueHistogram prints a histogram of when not-done tasks are due
+func PrintDueHistogram() {
+	fmt.Println("\n----- Due date distribution -----")
+	for _, bucket := range DueHistogram(taskList, now()) {
+		fmt.Printf("%-9s %s %d\n", bucket.label, strings.Repeat("#", bucket.count), bucket.count)
+	}
+	pause()
+}
+
+// BumpTask prompts for a task ID and raises (step -1) or lowers (step 1) its priority,
+// returning the ID or -1 if none was chosen
+func BumpTask(step int) int {
+	if len(taskList) == 0 {
+		fmt.Println("No tasks to change!")
+		return -1
+	}
+	id, ok := inputInt("Enter task ID to change priority: ", 0, len(taskList)-1)
+	if !ok {
+		fmt.Println("Invalid task ID!")
+		return -1
+	}
+	BumpPriority(&taskList[id], step)
+	return id
+}
+
+// BumpPriority moves a task's priority by step, staying within 1 to 3
+func BumpPriority(task *Task, step int) {
+	priority, err := strconv.Atoi(task.priority)
+	if err != nil {
+		priority = 3 // default priority
+	}
+	task.priority = strconv.Itoa(min(max(priority+step, 1), 3))
+	touch(task)
+	WriteAudit("edit", task.title)
+}
+
+// FindDuplicates returns groups of task indexes that share a title, ignoring case
+func FindDuplicates(tasks []Task) [][]int {
+	var groups [][]int
+	seen := map[string]int{} // title -> index in groups
+	for i, task := range tasks {
+		title := strings.ToLower(strings.TrimSpace(task.title))
+		if g, ok := seen[title]; ok {
+			groups[g] = append(groups[g], i)
+		} else {
+			seen[title] = len(groups)
+			groups = append(groups, []int{i})
+		}
+	}
+	return slices.DeleteFunc(groups, func(g []int) bool { return len(g) < 2 })
+}
+
+// MergeDuplicates merges each group of duplicate tasks into the one with the earliest
+// due date, combining their notes and labels, and returns the new list and how many
+// tasks were merged away
+func MergeDuplicates(tasks []Task) ([]Task, int) {
+	groups := FindDuplicates(tasks)
+	removed := map[int]bool{}
+	merged := slices.Clone(tasks)
+	for _, group := range groups {
+		keep := group[0]
+		for _, i := range group {
+			if tasks[i].due.Before(tasks[keep].due) {
+				keep = i
+			}
+		}
+		var notes, labels []string
+		for _, i := range group {
+			if tasks[i].notes != "" && !slices.Contains(notes, tasks[i].notes) {
+				notes = append(notes, tasks[i].notes)
+			}
+			for _, tag := range SplitTags(tasks[i].label) {
+				if !slices.Contains(labels, tag) {
+					labels = append(labels, tag)
 				}
-				taskList[i].done = "No" // mark as not done
 			}
+			if i != keep {
+				removed[i] = true
+				WriteAudit("remove", tasks[i].title)
+			}
+		}
+		merged[keep].notes = strings.Join(notes, "; ")
+		merged[keep].label = strings.Join(labels, ",")
+		touch(&merged[keep])
+		WriteAudit("edit", merged[keep].title)
+	}
+
+	var result []Task
+	for i, task := range merged {
+		if !removed[i] {
+			result = append(result, task)
 		}
 	}
+	return result, len(removed)
 }
 
-// DoneTask marks a task as done by ID
-func DoneTask() {
+// MergeDuplicateTasks lists tasks with the same title and offers to merge them
+func MergeDuplicateTasks() {
+	groups := FindDuplicates(taskList)
+	if len(groups) == 0 {
+		fmt.Println("No duplicate tasks found.")
+		pause()
+		return
+	}
+	fmt.Print("\033[H\033[2J") // clear the terminal screen
+	for _, group := range groups {
+		PrintTitleHeader()
+		for _, i := range group {
+			PrintTask(i, taskList[i])
+		}
+	}
+	if yesNoInput("\nMerge each group, keeping the earliest due date?") != "Yes" {
+		return
+	}
+	var count int
+	taskList, count = MergeDuplicates(taskList)
+	fmt.Printf("Merged %d duplicate tasks.\n", count)
+	pause()
+}
+
+// sessionsPath returns the path of the file logging focus sessions
+func sessionsPath() string {
+	return filepath.Join(config.folderPath, "TaskManGo-sessions.log")
+}
+
+var afterMinute = func() <-chan time.Time { return time.After(time.Minute) } // replaceable for testing
+
+// FocusTimer runs a countdown timer for a task and logs the session when it ends
+func FocusTimer() {
 	if len(taskList) == 0 {
-		fmt.Println("No tasks to mark as done!")
+		fmt.Println("No tasks to focus on!")
 		return
 	}
-	id := inputInt("Enter task ID to mark as done: ", 0, len(taskList)-1)
-	if id < 0 {
+	id, ok := inputInt("Enter task ID to focus on: ", 0, len(taskList)-1)
+	if !ok {
 		fmt.Println("Invalid task ID!")
 		return
 	}
-	taskList[id].done = "Yes"
-	fmt.Println(taskList[id])
+	minutes, err := strconv.Atoi(inputStr("Minutes (Enter for 25): ", 3))
+	if err != nil || minutes < 1 {
+		minutes = 25
+	}
+	title := taskList[id].title
+
+	start := now()
+	stop := make(chan string)
+	go func() { stop <- inputStr("", 1) }() // Enter stops the timer early
+	fmt.Printf("\nFocusing on '%s'. Press Enter to stop early.\n", title)
+	remaining := minutes
+	cancelled := false
+	for remaining > 0 && !cancelled {
+		fmt.Printf("%d minutes left\n", remaining)
+		select {
+		case <-stop:
+			cancelled = true
+		case <-afterMinute():
+			remaining--
+		}
+	}
+	duration := time.Duration(minutes) * time.Minute
+	if cancelled {
+		duration = now().Sub(start).Round(time.Minute)
+		fmt.Println("Focus session stopped.")
+	} else {
+		fmt.Print("\aTime's up! Press Enter to continue.")
+		<-stop
+	}
+	if err := LogSession(sessionsPath(), title, start, duration); err != nil {
+		fmt.Println("Error writing sessions file!")
+		pause()
+	}
+}
+
+// LogSession appends a focus session (start time, minutes, task title) to the sessions file
+func LogSession(path string, title string, start time.Time, duration time.Duration) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if err := writer.Write([]string{start.Format("2006-01-02 15:04"), strconv.Itoa(int(duration.Minutes())), title}); err != nil {
+		return err
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// mergeKey identifies the same task in two data files: its title, and when it was created if known
+func mergeKey(task Task) string {
+	return strings.ToLower(task.title) + "|" + formatStamp(task.created)
+}
+
+// MergeTaskLists combines two versions of a task list. Tasks in both (by mergeKey) that differ
+// are conflicts, resolved by keeping the more recently modified version, or a's if neither is
+// newer. Tasks in only one list are all kept, a's first. Returns the merged list and the conflicts.
+func MergeTaskLists(a []Task, b []Task) ([]Task, int) {
+	inB := map[string]int{}
+	for i, task := range b {
+		inB[mergeKey(task)] = i
+	}
+	var merged []Task
+	used := make([]bool, len(b))
+	conflicts := 0
+	for _, task := range a {
+		i, ok := inB[mergeKey(task)]
+		if ok && !used[i] {
+			used[i] = true
+			other := b[i]
+			if !slices.Equal(taskFields(task), taskFields(other)) {
+				conflicts++
+				if other.modified.After(task.modified) {
+					task = other
+				}
+			}
+		}
+		merged = append(merged, task)
+	}
+	for i, task := range b {
+		if !used[i] {
+			merged = append(merged, task)
+		}
+	}
+	return merged, conflicts
+}
+
+// RunMerge merges two data files from the command line, eg. "merge fileA fileB --out merged",
+// returning the exit code
+func RunMerge(args []string) int {
+	var files []string
+	out := ""
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--out" && i+1 < len(args) {
+			i++
+			out = args[i]
+		} else {
+			files = append(files, args[i])
+		}
+	}
+	if len(files) != 2 || out == "" {
+		fmt.Fprintln(os.Stderr, "usage: merge fileA fileB --out merged")
+		return 2
+	}
+	a, err := LoadTasks(files[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "merge:", err)
+		return 1
+	}
+	b, err := LoadTasks(files[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "merge:", err)
+		return 1
+	}
+	merged, conflicts := MergeTaskLists(a, b)
+	if err := SaveTasks(out, merged); err != nil {
+		fmt.Fprintln(os.Stderr, "merge:", err)
+		return 1
+	}
+	fmt.Printf("Merged %d and %d tasks into %d, resolving %d conflicts. Saved to: %s\n",
+		len(a), len(b), len(merged), conflicts, out)
+	return 0
+}
+
+// LabelFlag takes "--label work" (or "--label=work") out of the command line arguments,
+// returning the label and the other arguments, or an error if the label is missing
+func LabelFlag(args []string) (string, []string, error) {
+	label := ""
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		value, ok := strings.CutPrefix(args[i], "--label=")
+		if args[i] == "--label" && i+1 < len(args) {
+			i++
+			value, ok = args[i], true
+		} else if args[i] == "--label" {
+			value, ok = "", true // with nothing after it
+		}
+		if !ok {
+			rest = append(rest, args[i])
+			continue
+		}
+		label = strings.TrimSpace(value)
+		if label == "" {
+			return "", nil, errors.New("--label needs a label, eg. --label work")
+		}
+	}
+	return label, rest, nil
+}
+
+// StartLabel chooses the label filter the session starts with: the --label flag,
+// or else the TASKMANGO_LABEL environment variable
+func StartLabel(flag string, env string) string {
+	if flag != "" {
+		return flag
+	}
+	return strings.TrimSpace(env)
+}
+
+type BatchResult struct { // what a headless run changed
+	added, completed, removed, failed int
+}
+
+func (r BatchResult) String() string {
+	summary := fmt.Sprintf("added %d, completed %d, removed %d", r.added, r.completed, r.removed)
+	if r.failed > 0 {
+		summary += fmt.Sprintf(", %d failed", r.failed)
+	}
+	return summary
+}
+
+// ExitCode returns 0 if every operation succeeded, 1 otherwise
+func (r BatchResult) ExitCode() int {
+	if r.failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// RunHeadless loads the tasks, runs commands from the command line with RunBatch, saves any changes
+// and prints a summary, never asking anything. It fails with exit code 2 if there is no config file
+// yet, since creating one means asking where to keep the tasks. Returns the exit code.
+func RunHeadless(args []string, label string) int {
+	if !LoadConfig() {
+		fmt.Fprintln(os.Stderr, "no config file at", configPath()+", run TaskManGo without arguments once to set it up")
+		return 2
+	}
+	ReadTasksFile()
+	SortBy(config.sortBy)
+	result := RunBatch(args, label)
+	if result.added+result.completed+result.removed > 0 && WriteTasksFile() != nil {
+		result.failed++ // the changes were lost
+	}
+	fmt.Println(result)
+	return result.ExitCode()
+}
+
+// RunBatch runs commands given on the command line, eg. add "Buy milk" done 3 remove 5.
+// Task IDs refer to the list as it is when each command runs. Added tasks are given label, if set.
+func RunBatch(args []string, label string) BatchResult {
+	var result BatchResult
+	for i := 0; i < len(args); i++ {
+		command := strings.ToLower(args[i])
+		if i+1 >= len(args) {
+			fmt.Fprintf(os.Stderr, "%s: missing argument\n", command)
+			result.failed++
+			break
+		}
+		i++
+		arg := args[i]
+		switch command {
+		case "add":
+			if arg == "" {
+				fmt.Fprintln(os.Stderr, "add: task title cannot be empty")
+				result.failed++
+				continue
+			}
+			taskList = append(taskList, Task{title: truncate(arg, maxTitleLength), due: noDueDate, priority: "3",
+				label: label, done: "No", created: now(), modified: now()})
+			WriteAudit("add", taskList[len(taskList)-1].title)
+			result.added++
+		case "done", "remove":
+			id, err := strconv.Atoi(arg)
+			if err != nil || id < 0 || id >= len(taskList) {
+				fmt.Fprintf(os.Stderr, "%s: invalid task ID %s\n", command, arg)
+				result.failed++
+				continue
+			}
+			WriteAudit(command, taskList[id].title)
+			if command == "done" {
+				setDone(&taskList[id], "Yes")
+				result.completed++
+			} else {
+				taskList = removeTaskAt(taskList, id)
+				result.removed++
+			}
+		default:
+			fmt.Fprintf(os.Stderr, "unknown command: %s\n", command)
+			result.failed++
+		}
+	}
+	return result
+}
+
+var rng = rand.New(rand.NewPCG(uint64(time.Now().UnixNano()), 0)) // replaceable with a fixed seed for testing
+
+// PickRandomTask returns the index of a random not-done task, or -1 if there are none.
+// If weighted, higher priority and sooner due tasks are more likely to be picked.
+func PickRandomTask(tasks []Task, r *rand.Rand, weighted bool) int {
+	var candidates, weights []int
+	total := 0
+	for i, task := range tasks {
+		if task.done == "Yes" {
+			continue
+		}
+		weight := 1
+		if weighted {
+			priority, err := strconv.Atoi(task.priority)
+			if err != nil {
+				priority = 3
+			}
+			weight = 2 * (4 - max(min(priority, 3), 1)) // 2 to 6 by priority
+			if !isUndated(task.due) {
+				weight += max(0, min(7, 7-daysBetween(now(), task.due))) // up to 7 more as it gets close
+			}
+		}
+		candidates = append(candidates, i)
+		weights = append(weights, weight)
+		total += weight
+	}
+	if total == 0 {
+		return -1
+	}
+	n := r.IntN(total)
+	for i, weight := range weights {
+		if n < weight {
+			return candidates[i]
+		}
+		n -= weight
+	}
+	return -1
+}
+
+// RandomTask picks a task to work on, with quick actions to mark it done or snooze it
+func RandomTask() {
+	weighted := yesNoInput("Favour urgent tasks?") == "Yes"
+	for {
+		id := PickRandomTask(taskList, rng, weighted)
+		if id < 0 {
+			fmt.Println("No tasks to pick from!")
+			pause()
+			return
+		}
+		fmt.Print("\n" + FormatHeader(listColumns))
+		PrintTask(id, taskList[id])
+		switch strings.ToLower(inputStr("\n(d)one, (s)nooze a day, (n)ext pick, Enter to go back: ", 5)) {
+		case "d", "done":
+			setDone(&taskList[id], "Yes")
+			WriteAudit("done", taskList[id].title)
+			return
+		case "s", "snooze":
+			if isUndated(taskList[id].due) {
+				taskList[id].due = Today().AddDate(0, 0, 1)
+			} else {
+				taskList[id].due = taskList[id].due.AddDate(0, 0, 1)
+			}
+			touch(&taskList[id])
+			WriteAudit("edit", taskList[id].title)
+			return
+		case "n", "next":
+			continue
+		default:
+			return
+		}
+	}
+}
+
+// PrintHelp lists all the commands available at the options prompt
+func PrintHelp() {
+	fmt.Println("\n----- Commands -----")
+	fmt.Println("a, add      Add a new task")
+	fmt.Println("e, edit     Edit a task, or e3 to edit task 3")
+	fmt.Println("v, view     Show all of a task's details, or v3 for task 3")
+	fmt.Println("i, inbox    Quickly add a task with just a title")
+	fmt.Println("triage      Fill in the details of inbox tasks")
+	fmt.Println("d, done     Mark a task as done, or d3 for task 3")
+	fmt.Println("alldone     Mark every task in the view done, except tentative ones")
+	fmt.Println("fixdates    Re-read due dates in other formats, optionally dropping times of day")
+	fmt.Println("s, sort     Sort the task list")
+	fmt.Println("f, filter   Filter the list by label")
+	fmt.Println("r, remove   Remove a task, or r3 for task 3")
+	fmt.Println("hist        Show when tasks are due, by week")
+	fmt.Println("audit       Show the latest entries in the log of changes")
+	fmt.Println("tags        Count open and done tasks for each tag")
+	fmt.Println("label       Label every task in the current view")
+	fmt.Println("shift       Move the due dates of a label's tasks by days or weeks")
+	fmt.Println("archive     Move done tasks to the archive file")
+	fmt.Println("restore     Move a task back from the archive")
+	fmt.Println("tmpl        Save, list and use task templates")
+	fmt.Println("export      Export tasks to a CSV file")
+	fmt.Println("saveas      Save a copy of the list to another file")
+	fmt.Println("import      Add tasks from a CSV file")
+	fmt.Println("search      Find tasks by title, label or notes")
+	fmt.Println("query       Filter the list, eg. priority<=2 and done=No or label=work")
+	fmt.Println("group       Toggle grouping the list by label")
+	fmt.Println("top N       Show only the first N tasks of the list, top 0 shows them all")
+	fmt.Println("copy        Copy the list to the clipboard")
+	fmt.Println("focus       Start a focus timer for a task")
+	fmt.Println("random      Pick a task to do for me")
+	fmt.Println("sub         Add or tick off a task's subtasks")
+	fmt.Println("est         Total the estimates of tasks in the current view")
+	fmt.Println("donelast    Toggle sorting done tasks to the bottom")
+	fmt.Println("autosort    Toggle re-sorting the list after every change")
+	fmt.Println("up          Raise a task's priority")
+	fmt.Println("down        Lower a task's priority")
+	fmt.Println("dupes       Find and merge tasks with the same title")
+	fmt.Println("oldest      List the tasks that have been open longest")
+	fmt.Println("health      Check recurring tasks for problems")
+	fmt.Println("?s          Show quick stats above the prompt")
+	fmt.Println("h, help     Show this list")
+	fmt.Println("Enter       Run the previous command again")
+	fmt.Println(".           Repeat the previous action exactly, if it is safe to")
+	fmt.Println("q, quit     Save and quit")
+	pause()
+}
+
+type Session struct { // state of the interactive main loop
+	label   string // active label filter
+	last    string // previous command, re-run by pressing Enter
+	lastArg string // what the previous command acted on, so "." can repeat it exactly
+	overlay string // shown once above the next prompt, eg. quick stats
+	query   Query  // active query filter
+	grouped bool   // if true, the list is grouped under label headers
+	top     int    // show only this many tasks, 0 for all
+}
+
+// RunCommand runs a command from the options prompt, returning true to quit.
+// Enter re-runs the previous command, "." repeats the previous action exactly.
+func (s *Session) RunCommand(choice string) bool {
+	switch choice {
+	case "":
+		if s.last == "" {
+			return false
+		}
+		choice = s.last
+	case ".":
+		return s.RepeatLast()
+	}
+	s.last, s.lastArg = choice, ""
+
+	if command, id, ok := ParseShortcut(choice); ok {
+		s.last = command // Enter asks for an ID again, rather than acting on whatever is now at id
+		if id >= len(taskList) {
+			fmt.Println("Invalid task ID!")
+			pause()
+			return false
+		}
+		switch command {
+		case "e":
+			EditTaskID(id)
+		case "d":
+			s.overlay = DoneTaskID(id)
+		case "r":
+			fmt.Println(RemoveTaskID(id))
+		case "v":
+			ViewTaskID(id)
+		}
+		return false
+	}
+	if n, ok := ParseTop(choice); ok {
+		s.top = n
+		return false
+	}
+
+	switch choice {
+	case "a", "add":
+		addTask()
+	case "e", "edit":
+		EditTask()
+	case "v", "view":
+		ViewTask()
+	case "i", "inbox":
+		AddInboxTask()
+	case "triage":
+		TriageInbox()
+	case "d", "done":
+		s.overlay = DoneTask()
+	case "s", "sort":
+		SortTasks()
+		s.lastArg = config.sortBy
+	case "f", "filter":
+		s.label = inputLabel("Enter label to filter by (leave empty for no filter): ")
+		s.lastArg = s.label
+	case "r", "remove":
+		fmt.Println(RemoveTask())
+	case "hist":
+		PrintDueHistogram()
+	case "audit":
+		PrintAudit()
+	case "tags":
+		PrintTagSummary()
+	case "label":
+		BulkLabel(s.label, s.query)
+	case "shift":
+		RescheduleLabel()
+	case "archive":
+		ArchiveDone()
+	case "restore":
+		RestoreFromArchive()
+	case "tmpl":
+		Templates()
+	case "export":
+		ExportTasks()
+	case "saveas":
+		SaveAs()
+	case "alldone":
+		AllDone(s.label, s.query)
+	case "fixdates":
+		FixDates()
+	case "import":
+		ImportTasks()
+	case "search":
+		SearchTasks()
+	case "query":
+		s.query = QueryTasks(s.query)
+	case "group":
+		s.grouped = !s.grouped // the list itself shows the change
+	case "top":
+		if n, ok := ParseTop("top " + inputStr("Show how many tasks (0 for all)? ", 4)); ok {
+			s.top = n
+		} else {
+			fmt.Println("Invalid number!") // keeping the limit as it was
+			pause()
+		}
+	case "copy":
+		CopyTasks(s.label, s.query)
+	case "focus":
+		FocusTimer()
+	case "random":
+		RandomTask()
+	case "sub":
+		EditSubtasks()
+	case "est":
+		PrintEstimate(s.label, s.query)
+	case "donelast":
+		ToggleDoneLast()
+	case "autosort":
+		ToggleAutoSort()
+	case "up", "down":
+		step := -1
+		if choice == "down" {
+			step = 1
+		}
+		if id := BumpTask(step); id >= 0 {
+			s.lastArg = mergeKey(taskList[id]) // the list may be re-sorted before "." is typed
+		}
+	case "dupes":
+		MergeDuplicateTasks()
+	case "oldest":
+		PrintOldest()
+	case "health":
+		PrintRecurringHealth()
+	case "?s":
+		s.overlay = Stats(taskList, now())
+	case "h", "help":
+		PrintHelp()
+	case "q", "quit":
+		s.last = "" // never repeat quitting
+		return true
+	default:
+		s.last = ""
+	}
+	return false
+}
+
+// RepeatLast repeats the previous action with the same target, if that is safe.
+// Anything that needs a fresh target, like done or remove, asks for it again instead.
+func (s *Session) RepeatLast() bool {
+	switch s.last {
+	case "":
+		return false
+	case "s", "sort":
+		SortBy(s.lastArg)
+	case "f", "filter":
+		s.label = s.lastArg
+	case "up", "down":
+		id := slices.IndexFunc(taskList, func(task Task) bool { return mergeKey(task) == s.lastArg })
+		if s.lastArg == "" || id < 0 { // the task has gone or been renamed, so ask which one
+			return s.RunCommand(s.last)
+		}
+		step := -1
+		if s.last == "down" {
+			step = 1
+		}
+		BumpPriority(&taskList[id], step)
+	default:
+		return s.RunCommand(s.last)
+	}
+	return false
 }
 
 // main function - start here!
 func main() {
-	ReadConfig()
+	SetClockFromEnv()
+	label, args, err := LabelFlag(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if len(args) > 0 && (args[0] == "merge" || args[0] == "export") && label != "" {
+		fmt.Fprintln(os.Stderr, args[0]+": --label can't be used here")
+		os.Exit(2)
+	}
+	if len(args) > 0 && args[0] == "merge" { // works on any two files, without the config
+		os.Exit(RunMerge(args[1:]))
+	}
+	if len(args) > 0 && args[0] == "export" { // reads the config and data file itself, asking nothing
+		os.Exit(RunExport(args[1:]))
+	}
+	if len(args) > 0 {
+		os.Exit(RunHeadless(args, label))
+	}
+	newConfig := ReadConfig()
 	ReadTasksFile()
-	SortTasksByDueDate()
+	SortBy(config.sortBy)
+	if newConfig {
+		OfferSampleTasks()
+	}
+	CheckWritable()
+	CheckTasksFile()
+	CheckNotes()
+	PrintChanges()
+	AutoArchive()
 	fmt.Println()
 	fmt.Print("\033[H\033[2J") // clear the terminal screen
 
-	fmt.Println("TaskManGo Task Manager:")
-	label := ""
+	session := &Session{label: StartLabel(label, os.Getenv("TASKMANGO_LABEL")), overlay: NotifyDue()}
 	quit := false
 	for !quit {
 		UpdateRecurringTasks()
-		ListTasks(label) // list tasks, filtered by label if set
+		AutoSort()
+		ListTasks(session.label, session.query, session.grouped, session.top) // filtered by label and query if set
+		PrintStatusLine(session.label, session.query)
 		DueTasks()
-		choice := strings.ToLower(inputStr("\nOptions: (a)dd, (e)dit, (d)one, (s)ort, (f)ilter, (r)emove, (q)uit? ", 5))
-		switch choice {
-		case "a", "add":
-			addTask()
-		case "e", "edit":
-			EditTask()
-		case "d", "done":
-			DoneTask()
-		case "s", "sort":
-			SortTasks()
-		case "f", "filter":
-			label = inputStr("Enter label to filter by (leave empty for no filter): ", 12)
-		case "r", "remove":
-			fmt.Println(RemoveTask())
-		case "q", "quit":
-			quit = true
-		}
-	}
-	WriteTasksFile()
+		if session.overlay != "" {
+			fmt.Println(session.overlay)
+			session.overlay = ""
+		}
+		choice := strings.ToLower(inputStr(MainPrompt(), 10))
+		quit = session.RunCommand(choice)
+	}
+	if WriteTasksFile() != nil {
+		SaveElsewhere()
+	}
 }
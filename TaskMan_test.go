@@ -0,0 +1,2732 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testNow = time.Date(2026, 10, 16, 9, 0, 0, 0, time.Local) // a Friday
+
+// setup gives a test an empty list, a default config, a fixed clock and its own home folder,
+// putting everything back afterwards
+func setup(t *testing.T) {
+	t.Helper()
+	savedList, savedConfig, savedNow, savedInput := taskList, config, now, input
+	t.Cleanup(func() {
+		taskList, config, now, input = savedList, savedConfig, savedNow, savedInput
+	})
+	t.Setenv("HOME", t.TempDir())
+	taskList = nil
+	config = Config{dueSoonDays: 3, sortBy: "due", weekStart: "Monday", busyDay: 5, maxNoteLength: 500,
+		locale: "en", header: defaultHeader, notify: "Off", doneMarkers: "words"}
+	config.folderPath = t.TempDir()
+	config.filePath = filepath.Join(config.folderPath, "TaskManGo.txt")
+	now = func() time.Time { return testNow }
+}
+
+// typeInput makes the following prompts read these lines, as if typed
+func typeInput(lines ...string) {
+	input = bufio.NewScanner(strings.NewReader(strings.Join(lines, "\n") + "\n"))
+}
+
+// captureOutput returns what f prints
+func captureOutput(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := os.Stdout
+	os.Stdout = w
+	printed := make(chan string)
+	go func() {
+		out, _ := io.ReadAll(r)
+		printed <- string(out)
+	}()
+	defer func() { os.Stdout = saved }()
+	f()
+	w.Close()
+	return <-printed
+}
+
+func TestOfferSampleTasks(t *testing.T) {
+	setup(t)
+	typeInput("n")
+	captureOutput(t, OfferSampleTasks)
+	if len(taskList) != 0 {
+		t.Fatalf("declined, but got %d tasks", len(taskList))
+	}
+	typeInput("y")
+	captureOutput(t, OfferSampleTasks)
+	if len(taskList) != len(SampleTasks(testNow)) {
+		t.Fatalf("accepted, got %d tasks, want %d", len(taskList), len(SampleTasks(testNow)))
+	}
+	typeInput("y")
+	taskList = taskList[:1]
+	captureOutput(t, OfferSampleTasks) // an existing list isn't added to
+	if len(taskList) != 1 {
+		t.Errorf("existing list changed to %d tasks", len(taskList))
+	}
+}
+
+func TestParseDayNameLocalized(t *testing.T) {
+	tests := []struct {
+		locale, input string
+		want          time.Time
+	}{
+		{"fr", "demain", time.Date(2026, 10, 17, 0, 0, 0, 0, time.Local)},
+		{"fr", "lundi", time.Date(2026, 10, 19, 0, 0, 0, 0, time.Local)},
+		{"de", "Freitag", time.Date(2026, 10, 23, 0, 0, 0, 0, time.Local)}, // today is Friday, so next week
+		{"es", "miércoles", time.Date(2026, 10, 21, 0, 0, 0, 0, time.Local)},
+		{"es", "hoy", time.Date(2026, 10, 16, 0, 0, 0, 0, time.Local)},
+	}
+	for _, tt := range tests {
+		got, ok := ParseDayName(tt.input, locales[tt.locale], testNow)
+		if !ok || !got.Equal(tt.want) {
+			t.Errorf("ParseDayName(%q, %s) = %v, %v; want %v", tt.input, tt.locale, got, ok, tt.want)
+		}
+	}
+	if _, ok := ParseDayName("monday", locales["fr"], testNow); ok {
+		t.Error("English weekday accepted in the French locale")
+	}
+}
+
+func TestParseMonthDate(t *testing.T) {
+	tests := []struct {
+		locale, input string
+		want          time.Time
+		ok            bool
+	}{
+		{"en", "3 mar", time.Date(2027, 3, 3, 0, 0, 0, 0, time.Local), true}, // already past this year
+		{"en", "December 25", time.Date(2026, 12, 25, 0, 0, 0, 0, time.Local), true},
+		{"en", "16 oct", time.Date(2026, 10, 16, 0, 0, 0, 0, time.Local), true},
+		{"fr", "3 mars 2028", time.Date(2028, 3, 3, 0, 0, 0, 0, time.Local), true},
+		{"de", "24. dezember", time.Date(2026, 12, 24, 0, 0, 0, 0, time.Local), true},
+		{"es", "1 ene", time.Date(2027, 1, 1, 0, 0, 0, 0, time.Local), true},
+		{"en", "31 feb", time.Time{}, false},
+		{"en", "3 mars", time.Date(2027, 3, 3, 0, 0, 0, 0, time.Local), true},
+		{"fr", "3 mar", time.Time{}, false},
+		{"en", "mar", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseMonthDate(tt.input, locales[tt.locale], testNow)
+		if ok != tt.ok || !got.Equal(tt.want) {
+			t.Errorf("ParseMonthDate(%q, %s) = %v, %v; want %v, %v", tt.input, tt.locale, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRelativeDateLocalized(t *testing.T) {
+	tests := []struct {
+		locale string
+		due    time.Time
+		want   string
+	}{
+		{"fr", time.Date(2026, 10, 16, 0, 0, 0, 0, time.Local), "aujourd'hui"},
+		{"de", time.Date(2026, 10, 17, 14, 30, 0, 0, time.Local), "morgen 14:30"},
+		{"es", time.Date(2026, 10, 21, 0, 0, 0, 0, time.Local), "miércoles"},
+		{"fr", time.Date(2026, 12, 3, 0, 0, 0, 0, time.Local), "3 déc"},
+		{"de", time.Date(2027, 3, 3, 0, 0, 0, 0, time.Local), "3 mär 2027"},
+		{"en", noDueDate, ""},
+	}
+	for _, tt := range tests {
+		if got := RelativeDate(tt.due, testNow, locales[tt.locale]); got != tt.want {
+			t.Errorf("RelativeDate(%v, %s) = %q, want %q", tt.due, tt.locale, got, tt.want)
+		}
+	}
+}
+
+func TestParseDueInputUsesLocale(t *testing.T) {
+	setup(t)
+	config.locale = "fr"
+	got, err := ParseDueInput("vendredi")
+	if want := time.Date(2026, 10, 23, 0, 0, 0, 0, time.Local); err != nil || !got.Equal(want) {
+		t.Errorf("ParseDueInput(vendredi) = %v, %v; want %v", got, err, want)
+	}
+	got, err = ParseDueInput("2 janvier")
+	if want := time.Date(2027, 1, 2, 0, 0, 0, 0, time.Local); err != nil || !got.Equal(want) {
+		t.Errorf("ParseDueInput(2 janvier) = %v, %v; want %v", got, err, want)
+	}
+}
+
+func TestNormalizeDates(t *testing.T) {
+	setup(t)
+	timed := time.Date(2026, 10, 20, 10, 0, 0, 0, time.Local)
+	tasks := []Task{
+		{title: "Timed", due: timed},
+		{title: "Slashes", badDue: "2026/10/21"},
+		{title: "Words", badDue: "next tuesday"},
+		{title: "Clean", due: time.Date(2026, 10, 22, 0, 0, 0, 0, time.Local)},
+	}
+	normalized, unreadable := NormalizeDates(tasks, false)
+	if normalized != 1 || !slices.Equal(unreadable, []int{2}) {
+		t.Fatalf("NormalizeDates keeping times = %d, %v; want 1, [2]", normalized, unreadable)
+	}
+	if !tasks[0].due.Equal(timed) {
+		t.Errorf("time of day dropped without asking: %v", tasks[0].due)
+	}
+	if want := time.Date(2026, 10, 21, 0, 0, 0, 0, time.Local); !tasks[1].due.Equal(want) || tasks[1].badDue != "" {
+		t.Errorf("re-read due = %v (%q), want %v", tasks[1].due, tasks[1].badDue, want)
+	}
+	if tasks[2].badDue != "next tuesday" {
+		t.Errorf("unreadable due date lost: %q", tasks[2].badDue)
+	}
+
+	normalized, unreadable = NormalizeDates(tasks, true)
+	if normalized != 1 || len(unreadable) != 1 {
+		t.Fatalf("NormalizeDates dropping times = %d, %v; want 1 and 1 unreadable", normalized, unreadable)
+	}
+	if hasTime(tasks[0].due) || !tasks[0].modified.Equal(testNow) {
+		t.Errorf("timed task = %v modified %v, want midnight modified now", tasks[0].due, tasks[0].modified)
+	}
+}
+
+func TestTopLimitsRows(t *testing.T) {
+	setup(t)
+	for i := range 5 {
+		taskList = append(taskList, Task{title: fmt.Sprintf("Row %d", i), due: noDueDate, priority: "3", done: "No"})
+	}
+	out := captureOutput(t, func() { ListTasks("", Query{}, false, 3) })
+	if rows := strings.Count(out, "Row "); rows != 3 || !strings.Contains(out, "(… and 2 more)") {
+		t.Errorf("top 3 of 5 showed %d rows:\n%s", rows, out)
+	}
+	out = captureOutput(t, func() { ListTasks("", Query{}, false, 0) })
+	if rows := strings.Count(out, "Row "); rows != 5 || strings.Contains(out, "more)") {
+		t.Errorf("no limit showed %d rows:\n%s", rows, out)
+	}
+
+	for i := range taskList {
+		taskList[i].label = "home,work" // each task is listed twice when grouped
+	}
+	out = captureOutput(t, func() { ListTasks("", Query{}, true, 4) })
+	if rows := strings.Count(out, "Row "); rows != 4 || !strings.Contains(out, "(… and 6 more)") {
+		t.Errorf("grouped top 4 showed %d rows:\n%s", rows, out)
+	}
+}
+
+func TestTopCommand(t *testing.T) {
+	setup(t)
+	s := &Session{}
+	captureOutput(t, func() { s.RunCommand("top 2") })
+	if s.top != 2 {
+		t.Fatalf("top 2 set the limit to %d", s.top)
+	}
+	typeInput("lots", "")
+	out := captureOutput(t, func() { s.RunCommand("top") })
+	if s.top != 2 || !strings.Contains(out, "Invalid number!") {
+		t.Errorf("bad input changed the limit to %d, printing %q", s.top, out)
+	}
+	typeInput("0")
+	captureOutput(t, func() { s.RunCommand("top") })
+	if s.top != 0 {
+		t.Errorf("top 0 left the limit at %d", s.top)
+	}
+}
+
+func TestLabelFlag(t *testing.T) {
+	tests := []struct {
+		args  []string
+		label string
+		rest  []string
+		ok    bool
+	}{
+		{[]string{"--label", "work"}, "work", nil, true},
+		{[]string{"--label=home", "add", "x"}, "home", []string{"add", "x"}, true},
+		{[]string{"add", "x", "--label", "work"}, "work", []string{"add", "x"}, true},
+		{[]string{"add", "x"}, "", []string{"add", "x"}, true},
+		{[]string{"add", "x", "--label"}, "", nil, false},
+		{[]string{"--label="}, "", nil, false},
+	}
+	for _, tt := range tests {
+		label, rest, err := LabelFlag(tt.args)
+		if label != tt.label || !slices.Equal(rest, tt.rest) || (err == nil) != tt.ok {
+			t.Errorf("LabelFlag(%q) = %q, %q, %v; want %q, %q, ok %v", tt.args, label, rest, err, tt.label, tt.rest, tt.ok)
+		}
+	}
+}
+
+func TestLaunchWithLabel(t *testing.T) {
+	setup(t)
+	taskList = []Task{
+		{title: "Report", due: noDueDate, priority: "3", label: "work", done: "No"},
+		{title: "Garden", due: noDueDate, priority: "3", label: "home", done: "No"},
+	}
+	label, _, _ := LabelFlag([]string{"--label", "work"})
+	s := Session{label: StartLabel(label, "home")} // the flag wins over TASKMANGO_LABEL
+	out := captureOutput(t, func() { ListTasks(s.label, s.query, s.grouped, s.top) })
+	if !strings.Contains(out, "Report") || strings.Contains(out, "Garden") {
+		t.Errorf("list not filtered by --label work:\n%s", out)
+	}
+
+	label, args, _ := LabelFlag([]string{"--label", "work", "add", "Call Sam"})
+	captureOutput(t, func() { RunBatch(args, label) })
+	if added := taskList[len(taskList)-1]; added.title != "Call Sam" || added.label != "work" {
+		t.Errorf("batch add = %q labelled %q, want Call Sam labelled work", added.title, added.label)
+	}
+}
+
+func TestParseFieldChoice(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int
+		ok    bool
+	}{
+		{"", 0, true}, // cancels
+		{"  ", 0, true},
+		{"0", 0, true},
+		{"1", 1, true},
+		{" 11 ", 11, true},
+		{"12", 0, false},
+		{"-1", 0, false},
+		{"x", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseFieldChoice(tt.input, 11)
+		if got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("ParseFieldChoice(%q, 11) = %d, %v; want %d, ok %v", tt.input, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParsePriority(t *testing.T) {
+	tests := []struct {
+		input, want string
+		ok          bool
+	}{
+		{"1", "1", true},
+		{"2", "2", true},
+		{"3", "3", true},
+		{"critical", "1", true},
+		{"High", "2", true},
+		{"medium", "2", true},
+		{" low ", "3", true},
+		{"med", "2", true},
+		{"cr", "1", true},
+		{"h", "2", true},
+		{"c", "1", true},
+		{"4", "", false},
+		{"urgent", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, err := ParsePriority(tt.input)
+		if got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("ParsePriority(%q) = %q, %v; want %q, ok %v", tt.input, got, err, tt.want, tt.ok)
+		}
+	}
+	for priority, name := range map[string]string{"1": "critical", "2": "high", "3": "low", "9": ""} {
+		if got := PriorityName(priority); got != name {
+			t.Errorf("PriorityName(%q) = %q, want %q", priority, got, name)
+		}
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	setup(t)
+	task := Task{title: "Pack for trip", due: testNow, priority: "2", repeat: "P1M", label: "travel", done: "Yes",
+		subtasks: []Subtask{{"Passport", true}, {"Charger", false}}}
+	if err := SaveTemplate(NewTemplate(task)); err != nil {
+		t.Fatal(err)
+	}
+	task.priority = "1"
+	if err := SaveTemplate(NewTemplate(task)); err != nil { // same title, so replaces the first
+		t.Fatal(err)
+	}
+	if err := SaveTemplate(NewTemplate(Task{title: "Weekly shop", priority: "3"})); err != nil {
+		t.Fatal(err)
+	}
+	templates, err := LoadTasks(templatesPath())
+	if err != nil || len(templates) != 2 {
+		t.Fatalf("listed %d templates (%v), want 2", len(templates), err)
+	}
+	saved := templates[0]
+	if saved.title != "Pack for trip" || saved.priority != "1" || !isUndated(saved.due) || saved.done != "No" ||
+		len(saved.subtasks) != 2 || saved.subtasks[0].done {
+		t.Errorf("saved template = %+v, want the task undated, not done, with its subtasks unticked", saved)
+	}
+
+	due := time.Date(2026, 11, 1, 0, 0, 0, 0, time.Local)
+	made := Instantiate(saved, due)
+	made.subtasks[0].done = true
+	if !made.due.Equal(due) || made.done != "No" || !made.created.Equal(testNow) || saved.subtasks[0].done {
+		t.Errorf("instantiated %+v, changing the template's subtasks: %v", made, saved.subtasks[0].done)
+	}
+}
+
+func TestTemplatesCancel(t *testing.T) {
+	setup(t)
+	if err := SaveTemplate(Task{title: "Weekly shop", due: noDueDate, priority: "3", done: "No"}); err != nil {
+		t.Fatal(err)
+	}
+	typeInput("u", "")
+	out := captureOutput(t, Templates)
+	if len(taskList) != 0 || strings.Contains(out, "out of range") {
+		t.Errorf("Enter didn't cancel cleanly, added %d tasks:\n%s", len(taskList), out)
+	}
+	typeInput("u", "0", "")
+	captureOutput(t, Templates)
+	if len(taskList) != 1 || taskList[0].title != "Weekly shop" {
+		t.Errorf("using template 0 gave %v", taskList)
+	}
+}
+
+func TestParseDueTimeOfDay(t *testing.T) {
+	tests := []struct {
+		input  string
+		want   time.Time
+		ok     bool
+		format string
+	}{
+		{"2026-10-20", time.Date(2026, 10, 20, 0, 0, 0, 0, time.Local), true, "2026-10-20"},
+		{"2026-10-20 14:30", time.Date(2026, 10, 20, 14, 30, 0, 0, time.Local), true, "2026-10-20 14:30"},
+		{"2026-10-20 00:00", time.Date(2026, 10, 20, 0, 0, 0, 0, time.Local), true, "2026-10-20"},
+		{"2026-10-20 25:00", time.Time{}, false, ""},
+		{"2026-10-20 9am", time.Time{}, false, ""},
+	}
+	for _, tt := range tests {
+		got, err := ParseDue(tt.input)
+		if (err == nil) != tt.ok || !got.Equal(tt.want) {
+			t.Errorf("ParseDue(%q) = %v, %v; want %v, ok %v", tt.input, got, err, tt.want, tt.ok)
+		}
+		if tt.ok && FormatDue(got) != tt.format {
+			t.Errorf("FormatDue(%v) = %q, want %q", got, FormatDue(got), tt.format)
+		}
+	}
+}
+
+func TestIsOverdueBoundary(t *testing.T) {
+	setup(t)
+	at := func(day, hour, minute int) time.Time { return time.Date(2026, 10, day, hour, minute, 0, 0, time.Local) }
+	tests := []struct {
+		due, now time.Time
+		overdue  bool
+		today    bool
+	}{
+		{at(16, 14, 30), at(16, 14, 29), false, true}, // a minute to go
+		{at(16, 14, 30), at(16, 14, 30), false, true}, // due now isn't overdue yet
+		{at(16, 14, 30), at(16, 14, 31), true, false},
+		{at(16, 0, 0), at(16, 23, 59), false, true}, // date-only is due all day
+		{at(16, 0, 0), at(17, 0, 0), true, false},
+		{at(17, 0, 0), at(16, 23, 59), false, false},
+	}
+	for _, tt := range tests {
+		if got := IsOverdue(tt.due, tt.now); got != tt.overdue {
+			t.Errorf("IsOverdue(%v, %v) = %v, want %v", tt.due, tt.now, got, tt.overdue)
+		}
+		if got := IsDueToday(tt.due, tt.now); got != tt.today {
+			t.Errorf("IsDueToday(%v, %v) = %v, want %v", tt.due, tt.now, got, tt.today)
+		}
+	}
+}
+
+func TestListHeader(t *testing.T) {
+	setup(t)
+	out := captureOutput(t, func() { ListTasks("", Query{}, false, 0) })
+	if !strings.Contains(out, defaultHeader) || !strings.Contains(out, "No tasks found") {
+		t.Errorf("empty list without the default header:\n%s", out)
+	}
+	config.header = "Sam's jobs"
+	taskList = []Task{{title: "Paint", due: noDueDate, priority: "3", done: "No"}}
+	out = captureOutput(t, func() { ListTasks("", Query{}, false, 0) })
+	if !strings.Contains(out, "Sam's jobs") || strings.Contains(out, defaultHeader) {
+		t.Errorf("custom header not shown instead of the default:\n%s", out)
+	}
+}
+
+func TestDueHistogram(t *testing.T) {
+	setup(t)
+	day := func(d int) time.Time { return startOfDay(testNow).AddDate(0, 0, d) }
+	tasks := []Task{
+		{title: "Late", due: day(-2), done: "No"},
+		{title: "Today", due: day(0), done: "No"},
+		{title: "Sunday", due: day(2), done: "No"},  // still this week, which started on Monday
+		{title: "Monday", due: day(3), done: "No"},  // next week
+		{title: "Week 8", due: day(51), done: "No"}, // the last of the eight weeks
+		{title: "Week 9", due: day(52), done: "No"}, // later
+		{title: "Undated", due: noDueDate, done: "No"},
+		{title: "Done", due: day(-2), done: "Yes"}, // not counted
+	}
+	buckets := DueHistogram(tasks, testNow)
+	if len(buckets) != 11 {
+		t.Fatalf("got %d buckets, want overdue, 8 weeks, later and undated", len(buckets))
+	}
+	want := []int{1, 2, 1, 0, 0, 0, 0, 0, 1, 1, 1}
+	for i, bucket := range buckets {
+		if bucket.count != want[i] {
+			t.Errorf("bucket %s = %d, want %d", bucket.label, bucket.count, want[i])
+		}
+	}
+	if buckets[1].label != "2026-W42" || buckets[0].label != "Overdue" || buckets[10].label != "Undated" {
+		t.Errorf("labels %q, %q, %q", buckets[0].label, buckets[1].label, buckets[10].label)
+	}
+}
+
+func TestRemoveKeepsSnapshot(t *testing.T) {
+	setup(t)
+	taskList = []Task{{title: "A"}, {title: "B"}, {title: "C"}}
+	snapshot := taskList
+	captureOutput(t, func() { RemoveTaskID(1) })
+	if len(taskList) != 2 || taskList[1].title != "C" {
+		t.Errorf("list after removing B = %v", taskList)
+	}
+	if snapshot[0].title != "A" || snapshot[1].title != "B" || snapshot[2].title != "C" {
+		t.Errorf("snapshot changed by the removal: %v", snapshot)
+	}
+}
+
+// addAnswers are the answers to addTask's prompts after the title and due date, all left blank
+var addAnswers = []string{"", "", "", "", "", "", "", ""}
+
+func TestAddRequiresDueDate(t *testing.T) {
+	setup(t)
+	config.requireDueDate = true
+	typeInput(append([]string{"Pay rent", "", "none", "2026-10-20"}, addAnswers...)...)
+	out := captureOutput(t, addTask)
+	if len(taskList) != 1 || !taskList[0].due.Equal(time.Date(2026, 10, 20, 0, 0, 0, 0, time.Local)) {
+		t.Fatalf("added %v, want Pay rent due 2026-10-20", taskList)
+	}
+	if n := strings.Count(out, "A due date is required!"); n != 2 {
+		t.Errorf("blank and none refused %d times, want 2:\n%s", n, out)
+	}
+
+	config.requireDueDate = false
+	typeInput(append([]string{"Someday", ""}, addAnswers...)...)
+	out = captureOutput(t, addTask)
+	if len(taskList) != 2 || !isUndated(taskList[1].due) || strings.Contains(out, "required") {
+		t.Errorf("without the policy, blank didn't mean no due date: %v\n%s", taskList, out)
+	}
+}
+
+func TestRepeatFromCompletion(t *testing.T) {
+	setup(t)
+	due := time.Date(2026, 10, 10, 0, 0, 0, 0, time.Local)
+	completed := time.Date(2026, 10, 14, 18, 0, 0, 0, time.Local) // done four days late
+	taskList = []Task{
+		{title: "From due", due: due, repeat: "Weekly", done: "Yes", completed: completed},
+		{title: "From done", due: due, repeat: "Weekly", done: "Yes", completed: completed, repeatFromDone: true},
+		{title: "Timed", due: due.Add(9 * time.Hour), repeat: "Daily", done: "Yes", completed: completed,
+			repeatFromDone: true},
+	}
+	UpdateRecurringTasks()
+	want := []time.Time{
+		time.Date(2026, 10, 17, 0, 0, 0, 0, time.Local),
+		time.Date(2026, 10, 21, 0, 0, 0, 0, time.Local),
+		time.Date(2026, 10, 15, 9, 0, 0, 0, time.Local), // keeps its time of day
+	}
+	for i, task := range taskList {
+		if !task.due.Equal(want[i]) || task.done != "No" {
+			t.Errorf("%s: due %v, done %s; want %v, No", task.title, task.due, task.done, want[i])
+		}
+	}
+}
+
+func TestColorizeKeepsWidth(t *testing.T) {
+	t.Setenv("NO_COLOR", "")
+	got := colorize("Buy milk", Red, 20)
+	visible, ok := strings.CutPrefix(got, Red)
+	visible, ok2 := strings.CutSuffix(visible, Reset)
+	if !ok || !ok2 || len(visible) != 20 || strings.TrimSpace(visible) != "Buy milk" {
+		t.Errorf("colorize = %q, want the text padded to 20 inside the color codes", got)
+	}
+	if got := colorize("Ünïcode", "", 10); len([]rune(got)) != 10 {
+		t.Errorf("uncolored cell %q is %d wide, want 10", got, len([]rune(got)))
+	}
+	t.Setenv("NO_COLOR", "1")
+	if got := colorize("Buy milk", Red, 20); got != fmt.Sprintf("%-20s", "Buy milk") {
+		t.Errorf("with NO_COLOR colorize = %q", got)
+	}
+}
+
+func TestAddWarnsAtCap(t *testing.T) {
+	setup(t)
+	config.maxTasks = 3
+	taskList = []Task{{title: "One", due: noDueDate}, {title: "Two", due: noDueDate}}
+	typeInput(append([]string{"Three", ""}, addAnswers...)...)
+	if out := captureOutput(t, addTask); strings.Contains(out, "Warning") {
+		t.Errorf("warned below the cap:\n%s", out)
+	}
+	typeInput(append([]string{"Four", ""}, addAnswers...)...)
+	out := captureOutput(t, addTask)
+	if !strings.Contains(out, "Warning: you have 3 tasks (limit 3)") {
+		t.Errorf("no warning adding past the cap:\n%s", out)
+	}
+	if len(taskList) != 4 {
+		t.Errorf("the cap is soft, but only %d tasks were kept", len(taskList))
+	}
+}
+
+func TestRestoreFromArchive(t *testing.T) {
+	setup(t)
+	archived := []Task{
+		{title: "Alpha", due: noDueDate, priority: "3", done: "Yes"},
+		{title: "Bravo", due: noDueDate, priority: "3", done: "Yes"},
+		{title: "Charlie", due: noDueDate, priority: "3", done: "Yes"},
+	}
+	if err := AppendToArchive(archived); err != nil {
+		t.Fatal(err)
+	}
+	taskList = []Task{{title: "Live", due: noDueDate, priority: "3", done: "No"}}
+
+	typeInput("1") // by ID
+	captureOutput(t, RestoreFromArchive)
+	typeInput("char") // by title
+	captureOutput(t, RestoreFromArchive)
+
+	if len(taskList) != 3 || taskList[1].title != "Bravo" || taskList[2].title != "Charlie" {
+		t.Errorf("live list = %v, want Live, Bravo, Charlie", taskList)
+	}
+	archive, err := LoadTasks(archivePath())
+	if err != nil || len(archive) != 1 || archive[0].title != "Alpha" {
+		t.Errorf("archive = %v (%v), want just Alpha", archive, err)
+	}
+}
+
+func TestFixedClock(t *testing.T) {
+	setup(t)
+	if !Today().Equal(time.Date(2026, 10, 16, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("Today() = %v with the clock fixed at %v", Today(), testNow)
+	}
+	taskList = []Task{{title: "Due", due: time.Date(2026, 10, 15, 0, 0, 0, 0, time.Local), done: "No"}}
+	if !IsOverdue(taskList[0].due, now()) {
+		t.Error("task due yesterday isn't overdue by the fixed clock")
+	}
+	now = func() time.Time { return time.Date(2026, 10, 14, 12, 0, 0, 0, time.Local) }
+	if IsOverdue(taskList[0].due, now()) {
+		t.Error("task due tomorrow is overdue after moving the clock back")
+	}
+
+	t.Setenv("TASKMANGO_TODAY", "2027-02-03")
+	SetClockFromEnv()
+	if got := Today(); !got.Equal(time.Date(2027, 2, 3, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("TASKMANGO_TODAY=2027-02-03 gave Today() = %v", got)
+	}
+	t.Setenv("TASKMANGO_TODAY", "not a date")
+	SetClockFromEnv() // ignored, leaving the clock as it was
+	if got := Today(); !got.Equal(time.Date(2027, 2, 3, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("a bad TASKMANGO_TODAY changed Today() to %v", got)
+	}
+}
+
+func TestUrgencyScoreOrder(t *testing.T) {
+	setup(t)
+	today := startOfDay(testNow)
+	task := func(title, priority string, days int) Task {
+		return Task{title: title, priority: priority, due: today.AddDate(0, 0, days), done: "No"}
+	}
+	tasks := []Task{
+		task("Low tomorrow", "3", 1),
+		task("High in 3 days", "1", 3),
+		task("Medium today", "2", 0),
+		task("High today", "1", 0),
+		task("Low today", "3", 0),
+		task("Unset today", "", 0), // counts as low
+	}
+	var got []string
+	for _, task := range DueSoon(tasks, testNow) {
+		got = append(got, task.title)
+	}
+	want := []string{"High today", "Medium today", "High in 3 days", "Low today", "Unset today", "Low tomorrow"}
+	if !slices.Equal(got, want) {
+		t.Errorf("DueSoon order = %q\nwant %q", got, want)
+	}
+	if a, b := UrgencyScore(tasks[1], today), UrgencyScore(tasks[0], today); a != 3 || b != 5 {
+		t.Errorf("high in 3 days scores %d, low tomorrow %d; want 3 and 5, two days a priority step", a, b)
+	}
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	setup(t)
+	path := filepath.Join(t.TempDir(), "tasks.csv")
+	tasks := []Task{
+		{title: "Report, final", due: time.Date(2026, 10, 20, 14, 30, 0, 0, time.Local), priority: "1",
+			repeat: "Weekly", repeatFromDone: true, label: "work,urgent", done: "Doing", notes: `He said "soon"`,
+			subtasks: []Subtask{{"Draft", true}}, color: "red", estimate: 90, tentative: true},
+		{title: "No date", due: noDueDate, priority: "3", done: "No"},
+	}
+	if err := ExportCSV(path, tasks); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if first, _, _ := strings.Cut(string(data), "\n"); first != strings.Join(csvHeader, ",") {
+		t.Errorf("header row = %q", first)
+	}
+	if !strings.Contains(string(data), "\nNo date,,3,") {
+		t.Errorf("undated task not exported with a blank due date:\n%s", data)
+	}
+	got, err := ImportCSV(path)
+	if err != nil || len(got) != 2 {
+		t.Fatalf("imported %d tasks (%v), want 2", len(got), err)
+	}
+	a, b := got[0], tasks[0]
+	if a.title != b.title || !a.due.Equal(b.due) || a.priority != b.priority || a.repeat != b.repeat ||
+		!a.repeatFromDone || a.label != b.label || a.done != b.done || a.notes != b.notes || a.color != b.color ||
+		a.estimate != b.estimate || !a.tentative || len(a.subtasks) != 1 || !a.subtasks[0].done {
+		t.Errorf("round trip gave %+v\nwant %+v", a, b)
+	}
+	if !isUndated(got[1].due) {
+		t.Errorf("blank due date imported as %v, want no due date", got[1].due)
+	}
+}
+
+func TestChooseColumns(t *testing.T) {
+	names := func(columns []Column) string {
+		var list []string
+		for _, c := range columns {
+			list = append(list, c.name)
+		}
+		return strings.Join(list, " ")
+	}
+	tests := []struct {
+		width int
+		want  string
+	}{
+		{200, "ID Title Due Prty Repeat Label Done"},
+		{columnsWidth(allColumns), "ID Title Due Prty Repeat Label Done"},
+		{columnsWidth(allColumns) - 1, "ID Title Due Prty Label Done"},
+		{60, "ID Title Due Prty Done"},
+		{40, "ID Title Due"},
+		{10, "ID Title Due"},
+	}
+	for _, tt := range tests {
+		if got := names(ChooseColumns(tt.width)); got != tt.want {
+			t.Errorf("ChooseColumns(%d) = %q, want %q", tt.width, got, tt.want)
+		}
+	}
+}
+
+func TestTerminalWidth(t *testing.T) {
+	saved := sttyWidth
+	t.Cleanup(func() { sttyWidth = saved })
+	t.Setenv("COLUMNS", "132")
+	if got := TerminalWidth(); got != 132 {
+		t.Errorf("COLUMNS=132 gave width %d", got)
+	}
+	t.Setenv("COLUMNS", "")
+	sttyWidth = 100 // as if stty had already been asked
+	if got := TerminalWidth(); got != 100 {
+		t.Errorf("cached width = %d, want 100", got)
+	}
+}
+
+func TestNoteSnippet(t *testing.T) {
+	t.Setenv("NO_COLOR", "1")
+	notes := "Ring the garage about the MOT before Friday, then book the service"
+	if got, want := NoteSnippet(notes, "mot", 10), "...about the **MOT** before Fr..."; got != want {
+		t.Errorf("NoteSnippet = %q, want %q", got, want)
+	}
+	if got, want := NoteSnippet(notes, "ring", 5), "**Ring** the ..."; got != want {
+		t.Errorf("match at the start = %q, want %q", got, want)
+	}
+	if got := NoteSnippet(notes, "dentist", 5); got != notes {
+		t.Errorf("no match = %q, want the notes unchanged", got)
+	}
+	t.Setenv("NO_COLOR", "")
+	if got := NoteSnippet("see MOT", "mot", 5); got != "see "+Yellow+"MOT"+Reset {
+		t.Errorf("colored snippet = %q", got)
+	}
+}
+
+func TestPartitionDoneByDue(t *testing.T) {
+	setup(t)
+	day := func(d int) time.Time { return startOfDay(testNow).AddDate(0, 0, d) }
+	taskList = []Task{
+		{title: "Done early", due: day(1), done: "Yes"},
+		{title: "Open late", due: day(5), done: "No"},
+		{title: "Recurring done", due: day(2), done: "Yes", repeat: "Daily"}, // comes back, so stays up
+		{title: "Open early", due: day(3), done: "Doing"},
+		{title: "Done late", due: day(4), done: "Yes"},
+	}
+	config.doneLast = true
+	SortTasksByDueDate()
+	var got []string
+	for _, task := range taskList {
+		got = append(got, task.title)
+	}
+	want := []string{"Recurring done", "Open early", "Open late", "Done early", "Done late"}
+	if !slices.Equal(got, want) {
+		t.Errorf("sorted by due with done last = %q\nwant %q", got, want)
+	}
+	config.doneLast = false
+	SortTasksByDueDate()
+	if taskList[0].title != "Done early" {
+		t.Errorf("without doneLast, first task is %q, want Done early", taskList[0].title)
+	}
+}
+
+func TestDistinctLabels(t *testing.T) {
+	tasks := []Task{
+		{label: "work"}, {label: ""}, {label: "home, work"}, {label: "work"}, {label: " ,errands,"}, {label: "home"},
+	}
+	if got, want := DistinctLabels(tasks), []string{"errands", "home", "work"}; !slices.Equal(got, want) {
+		t.Errorf("DistinctLabels = %q, want %q", got, want)
+	}
+	if got := DistinctLabels([]Task{{label: ""}}); len(got) != 0 {
+		t.Errorf("only empty labels gave %q", got)
+	}
+}
+
+func TestPickLabel(t *testing.T) {
+	labels := []string{"2", "home", "work"}
+	tests := []struct{ typed, want string }{
+		{"3", "work"},
+		{"1", "2"},
+		{"2", "2"}, // a label in use, not the second pick
+		{"2025", "2025"},
+		{"0", "0"},
+		{"-1", "-1"},
+		{"garden", "garden"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := PickLabel(tt.typed, labels); got != tt.want {
+			t.Errorf("PickLabel(%q) = %q, want %q", tt.typed, got, tt.want)
+		}
+	}
+
+	setup(t)
+	taskList = []Task{{title: "Plan", label: "home"}, {title: "Code", label: "work"}}
+	var label string
+	captureOutput(t, func() {
+		typeInput("2025")
+		label = inputLabel("Label: ")
+	})
+	if label != "2025" {
+		t.Errorf("typed 2025 with two labels listed, got %q", label)
+	}
+	captureOutput(t, func() {
+		typeInput("2")
+		label = inputLabel("Label: ")
+	})
+	if label != "work" {
+		t.Errorf("picked 2, got %q", label)
+	}
+}
+
+func TestBumpPriority(t *testing.T) {
+	setup(t)
+	tests := []struct {
+		priority string
+		step     int
+		want     string
+	}{
+		{"3", -1, "2"},
+		{"2", -1, "1"},
+		{"1", -1, "1"}, // already the highest
+		{"3", 1, "3"},  // already the lowest
+		{"1", 1, "2"},
+		{"", -1, "2"}, // unset counts as low
+	}
+	for _, tt := range tests {
+		task := Task{priority: tt.priority}
+		BumpPriority(&task, tt.step)
+		if task.priority != tt.want || !task.modified.Equal(testNow) {
+			t.Errorf("BumpPriority(%q, %d) = %q modified %v, want %q modified now",
+				tt.priority, tt.step, task.priority, task.modified, tt.want)
+		}
+	}
+}
+
+func TestMergeDuplicates(t *testing.T) {
+	setup(t)
+	day := func(d int) time.Time { return startOfDay(testNow).AddDate(0, 0, d) }
+	tasks := []Task{
+		{title: "Buy milk", due: day(3), label: "home", notes: "semi-skimmed", priority: "3"},
+		{title: "Call Sam", due: day(1)},
+		{title: "buy milk ", due: day(1), label: "errands,home", notes: "2 pints", priority: "1"},
+		{title: "Buy Milk", due: day(5), notes: "semi-skimmed"},
+	}
+	merged, removed := MergeDuplicates(tasks)
+	if removed != 2 || len(merged) != 2 {
+		t.Fatalf("merged into %d tasks, removing %d; want 2 and 2", len(merged), removed)
+	}
+	milk := merged[1] // the earliest due copy, kept in its place
+	if milk.title != "buy milk " || !milk.due.Equal(day(1)) || milk.priority != "1" {
+		t.Errorf("kept %+v, want the copy due soonest", milk)
+	}
+	if milk.notes != "semi-skimmed; 2 pints" || milk.label != "home,errands" {
+		t.Errorf("combined notes %q and label %q", milk.notes, milk.label)
+	}
+	if !milk.modified.Equal(testNow) {
+		t.Errorf("kept task modified = %v, want now", milk.modified)
+	}
+	if merged[0].title != "Call Sam" || tasks[0].notes != "semi-skimmed" {
+		t.Error("other tasks or the original list changed")
+	}
+}
+
+func TestCheckTasksFile(t *testing.T) {
+	setup(t)
+	content := fileHeader + "\n" +
+		"Good one,2026-10-20,1,,,No,\n" +
+		"just some text\n" +
+		"# a comment isn't a task\n" +
+		"\n" +
+		"Good two,2099-12-31,3,,home,No,\"notes over\ntwo lines\"\n" +
+		"Short,2026-10-20\n" +
+		"Good three,2026-10-21,2,,,Yes,\n"
+	if err := os.WriteFile(config.filePath, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	lines, err := CountTaskLines(config.filePath)
+	if err != nil || lines != 5 {
+		t.Fatalf("CountTaskLines = %d, %v; want 3 good and 2 bad lines", lines, err)
+	}
+	taskList, _ = LoadTasks(config.filePath)
+	if len(taskList) != 3 {
+		t.Fatalf("loaded %d tasks, want 3", len(taskList))
+	}
+
+	typeInput("y")
+	out := captureOutput(t, CheckTasksFile)
+	if !strings.Contains(out, "has 5 lines but only 3 tasks") {
+		t.Errorf("no warning about the bad lines:\n%s", out)
+	}
+	if lines, _ := CountTaskLines(config.filePath); lines != 3 {
+		t.Errorf("cleaned file has %d task lines, want 3", lines)
+	}
+	if backup, _ := os.ReadFile(config.filePath + ".bak"); string(backup) != content {
+		t.Error("original not kept as .bak")
+	}
+	if out := captureOutput(t, CheckTasksFile); out != "" {
+		t.Errorf("warned again about a clean file:\n%s", out)
+	}
+}
+
+func TestBadLinesKeptOnSave(t *testing.T) {
+	setup(t)
+	content := fileHeader + "\n" +
+		"Good one,2026-10-20,1,,,No,\n" +
+		"just some text\n" +
+		"Good two,2026-10-21,2,,,No,\n"
+	load := func() {
+		if err := os.WriteFile(config.filePath, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		os.Remove(config.filePath + ".bak")
+		taskList, _ = LoadTasks(config.filePath)
+	}
+
+	load()
+	out := captureOutput(t, func() {
+		typeInput("n")
+		CheckTasksFile()
+	})
+	if !strings.Contains(out, ".bak when the list is next saved") {
+		t.Errorf("declining printed:\n%s", out)
+	}
+	if data, _ := os.ReadFile(config.filePath); string(data) != content {
+		t.Error("declining changed the data file")
+	}
+	if _, err := os.Stat(config.filePath + ".bak"); err == nil {
+		t.Error("declining made a backup")
+	}
+	out = captureOutput(t, func() { WriteTasksFile() })
+	if backup, _ := os.ReadFile(config.filePath + ".bak"); string(backup) != content || !strings.Contains(out, "kept in:") {
+		t.Errorf("saving after declining didn't keep the bad lines:\n%s", out)
+	}
+
+	load() // headless, where CheckTasksFile doesn't run
+	WriteConfig()
+	captureOutput(t, func() { RunHeadless([]string{"done", "0"}, "") })
+	if backup, _ := os.ReadFile(config.filePath + ".bak"); string(backup) != content {
+		t.Error("batch save dropped the bad lines without a backup")
+	}
+	if lines, _ := CountTaskLines(config.filePath); lines != 2 {
+		t.Errorf("saved file has %d task lines, want 2", lines)
+	}
+
+	os.WriteFile(config.filePath+".bak", []byte("older backup"), 0o644)
+	captureOutput(t, func() { WriteTasksFile() }) // the file is clean now
+	if backup, _ := os.ReadFile(config.filePath + ".bak"); string(backup) != "older backup" {
+		t.Error("saving a clean file replaced the backup")
+	}
+}
+
+func TestAddedTaskSorted(t *testing.T) {
+	setup(t)
+	config.autoSort = true
+	day := func(d int) time.Time { return startOfDay(testNow).AddDate(0, 0, d) }
+	taskList = []Task{{title: "Later", due: day(3), done: "No"}, {title: "Much later", due: day(5), done: "No"}}
+	typeInput(append([]string{"Sooner", day(1).Format("2006-01-02")}, addAnswers...)...)
+	captureOutput(t, addTask)
+	AutoSort() // as the main loop does before listing
+	if taskList[0].title != "Sooner" {
+		t.Errorf("new task with the earliest due date is at %q's place", taskList[0].title)
+	}
+	config.autoSort = false
+	typeInput(append([]string{"Soonest", day(0).Format("2006-01-02")}, addAnswers...)...)
+	captureOutput(t, addTask)
+	AutoSort()
+	if taskList[len(taskList)-1].title != "Soonest" {
+		t.Error("with autoSort off, the new task didn't stay at the end")
+	}
+}
+
+func TestCopyTasks(t *testing.T) {
+	setup(t)
+	taskList = []Task{
+		{title: "Report", due: time.Date(2026, 10, 20, 0, 0, 0, 0, time.Local), priority: "1", label: "work", done: "No"},
+		{title: "Garden", due: noDueDate, priority: "3", label: "home", done: "No"},
+	}
+	text := RenderTasksText(taskList, ViewIDs(taskList, "work", Query{}, testNow))
+	if !strings.HasPrefix(text, FormatHeader(allColumns)) || !strings.Contains(text, "Report") ||
+		strings.Contains(text, "Garden") || strings.Contains(text, "\033[") {
+		t.Errorf("rendered text isn't the plain, filtered list:\n%s", text)
+	}
+
+	saved := clipboardCommand
+	t.Cleanup(func() { clipboardCommand = saved })
+	copied := filepath.Join(t.TempDir(), "clipboard")
+	clipboardCommand = func() *exec.Cmd { return exec.Command("sh", "-c", "cat > "+copied) }
+	typeInput("")
+	captureOutput(t, func() { CopyTasks("work", Query{}) })
+	if got, _ := os.ReadFile(copied); string(got) != text {
+		t.Errorf("clipboard got %q, want %q", got, text)
+	}
+
+	clipboardCommand = func() *exec.Cmd { return nil } // no clipboard tool
+	typeInput("")
+	out := captureOutput(t, func() { CopyTasks("work", Query{}) })
+	if !strings.Contains(out, "copy by hand") || !strings.Contains(out, text) {
+		t.Errorf("without a clipboard the list wasn't printed:\n%s", out)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	h := NewHistory(3)
+	if h.Len() != 0 || h.Recall(1) != "" {
+		t.Fatal("new history isn't empty")
+	}
+	h.Add("one")
+	h.Add("")    // blanks are skipped
+	h.Add("one") // so are repeats of the latest
+	h.Add("two")
+	if h.Len() != 2 || h.Recall(1) != "two" || h.Recall(2) != "one" || h.Recall(3) != "" {
+		t.Errorf("after one, two: len %d, recall %q %q %q", h.Len(), h.Recall(1), h.Recall(2), h.Recall(3))
+	}
+	h.Add("three")
+	h.Add("four") // wraps round, dropping one
+	var got []string
+	for n := 1; n <= h.Len(); n++ {
+		got = append(got, h.Recall(n))
+	}
+	if !slices.Equal(got, []string{"four", "three", "two"}) || h.Recall(0) != "" || h.Recall(4) != "" {
+		t.Errorf("after wrapping, recalled %q", got)
+	}
+}
+
+func TestInputRecall(t *testing.T) {
+	setup(t)
+	saved := inputHistory
+	t.Cleanup(func() { inputHistory = saved })
+	inputHistory = map[string]*History{}
+	typeInput("Buy milk", "Call Sam", "!", "!2", "!9")
+	var got []string
+	captureOutput(t, func() {
+		for range 5 {
+			got = append(got, inputRecall("title", "Task title: ", 30))
+		}
+	})
+	want := []string{"Buy milk", "Call Sam", "Call Sam", "Buy milk", "!9"}
+	if !slices.Equal(got, want) {
+		t.Errorf("inputRecall gave %q, want %q", got, want)
+	}
+}
+
+func TestInbox(t *testing.T) {
+	setup(t)
+	task := NewInboxTask("Fix the gate")
+	if task.label != "inbox" || !isUndated(task.due) || task.priority != "3" || task.done != "No" ||
+		!task.created.Equal(testNow) {
+		t.Errorf("NewInboxTask = %+v", task)
+	}
+
+	taskList = []Task{NewInboxTask("Fix the gate"), {title: "Other", label: "home"}, NewInboxTask("Renew passport"),
+		NewInboxTask("Book MOT")}
+	typeInput(
+		"t", "2026-10-20", "1", "", "home", "Needs a hinge", // triage the gate
+		"s", // skip the passport
+		"q", // stop before the MOT
+	)
+	captureOutput(t, TriageInbox)
+	gate := taskList[0]
+	if gate.label != "home" || gate.priority != "1" || gate.notes != "Needs a hinge" ||
+		!gate.due.Equal(time.Date(2026, 10, 20, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("triaged task = %+v", gate)
+	}
+	if taskList[2].label != "inbox" || taskList[3].label != "inbox" {
+		t.Error("skipped or unreached tasks left the inbox")
+	}
+
+	taskList = []Task{{title: "Other", label: "home"}}
+	typeInput("")
+	if out := captureOutput(t, TriageInbox); !strings.Contains(out, "The inbox is empty!") {
+		t.Errorf("empty inbox:\n%s", out)
+	}
+}
+
+func TestLoadV1AndV2(t *testing.T) {
+	dir := t.TempDir()
+	v1 := filepath.Join(dir, "v1.txt")
+	if err := os.WriteFile(v1, []byte(`"Pay rent","2026-11-01","1","Monthly","home","No","Standing order"`+"\n"+
+		`"Walk","2099-12-31","3","","","Yes",""`+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tasks, err := LoadTasks(v1)
+	if err != nil || len(tasks) != 2 || tasks[0].title != "Pay rent" || tasks[0].repeat != "Monthly" ||
+		tasks[0].notes != "Standing order" || tasks[1].done != "Yes" {
+		t.Fatalf("v1 load = %+v, %v", tasks, err)
+	}
+
+	if err := SaveTasks(v1, tasks); err != nil { // saving always writes v2
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(v1)
+	if !strings.HasPrefix(string(data), fileHeader+"\n") {
+		t.Errorf("saved file doesn't start with the v2 header:\n%s", data)
+	}
+	again, err := LoadTasks(v1)
+	if err != nil || len(again) != 2 || again[0].title != "Pay rent" || !again[0].due.Equal(tasks[0].due) ||
+		again[0].label != "home" {
+		t.Errorf("v2 reload = %+v, %v", again, err)
+	}
+
+	v2 := filepath.Join(dir, "v2.txt")
+	if err := os.WriteFile(v2, []byte(fileHeader+"\n"+`"Say ""hi"", then go",2026-10-20 09:15,2,,"a,b",Doing,`+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tasks, err = LoadTasks(v2)
+	if err != nil || len(tasks) != 1 || tasks[0].title != `Say "hi", then go` || tasks[0].label != "a,b" ||
+		tasks[0].done != "Doing" || !hasTime(tasks[0].due) {
+		t.Errorf("v2 load = %+v, %v", tasks, err)
+	}
+}
+
+func TestFocusTimerLogsSession(t *testing.T) {
+	setup(t)
+	taskList = []Task{{title: "Write report, part 1"}}
+	typed, typing := io.Pipe()
+	input = bufio.NewScanner(typed)
+	go fmt.Fprint(typing, "0\n2\n") // task 0 for 2 minutes
+	saved := afterMinute
+	t.Cleanup(func() { afterMinute = saved })
+	minutes := 0
+	afterMinute = func() <-chan time.Time {
+		minutes++
+		if minutes == 2 { // press Enter at "Time's up", once the last minute has passed
+			time.AfterFunc(50*time.Millisecond, func() { fmt.Fprint(typing, "\n") })
+		}
+		passed := make(chan time.Time, 1)
+		passed <- now()
+		return passed
+	}
+	out := captureOutput(t, FocusTimer)
+	if minutes != 2 || !strings.Contains(out, "Time's up!") {
+		t.Fatalf("timer ran %d minutes:\n%s", minutes, out)
+	}
+	data, err := os.ReadFile(sessionsPath())
+	if want := "2026-10-16 09:00,2,\"Write report, part 1\"\n"; err != nil || string(data) != want {
+		t.Errorf("sessions file = %q, %v; want %q", data, err, want)
+	}
+
+	if err := LogSession(sessionsPath(), "Second", testNow.Add(time.Hour), 25*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = os.ReadFile(sessionsPath())
+	if !strings.HasSuffix(string(data), "\n2026-10-16 10:00,25,Second\n") {
+		t.Errorf("second session not appended:\n%s", data)
+	}
+}
+
+func TestLongTitleWithCommas(t *testing.T) {
+	setup(t)
+	title := "Paint, sand, and varnish fence" // maxTitleLength characters
+	if len(title) != maxTitleLength {
+		t.Fatalf("test title is %d long", len(title))
+	}
+	taskList = []Task{{title: title, due: noDueDate, priority: "2", label: "home,garden", done: "No"}}
+	if err := SaveTasks(config.filePath, taskList); err != nil {
+		t.Fatal(err)
+	}
+	tasks, err := LoadTasks(config.filePath)
+	if err != nil || len(tasks) != 1 || tasks[0].title != title || tasks[0].label != "home,garden" ||
+		tasks[0].priority != "2" {
+		t.Fatalf("round trip = %+v, %v", tasks, err)
+	}
+
+	row := FormatRow(allColumns, 0, tasks[0], "")
+	shown := strings.TrimSpace(row[3:23]) // the Title column, after the 3 wide ID column
+	if shown != title[:19] || !strings.HasPrefix(row[23:], "  ") {
+		t.Errorf("title shown as %q in row %q, want the first 19 characters and a gap", shown, row)
+	}
+}
+
+func TestWeekStartBuckets(t *testing.T) {
+	setup(t)
+	sunday := time.Date(2026, 10, 18, 0, 0, 0, 0, time.Local)
+	tasks := []Task{{title: "Sunday", due: sunday, done: "No"}}
+
+	config.weekStart = "Monday" // Sunday ends this week
+	if got := weekStart(sunday); !got.Equal(time.Date(2026, 10, 12, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("Monday weeks: week of Sunday starts %v", got)
+	}
+	if buckets := DueHistogram(tasks, testNow); buckets[1].count != 1 {
+		t.Errorf("Monday weeks: Sunday not in this week's bucket %v", buckets[:3])
+	}
+
+	config.weekStart = "Sunday" // Sunday starts next week
+	if got := weekStart(sunday); !got.Equal(sunday) {
+		t.Errorf("Sunday weeks: week of Sunday starts %v", got)
+	}
+	if buckets := DueHistogram(tasks, testNow); buckets[2].count != 1 {
+		t.Errorf("Sunday weeks: Sunday not in next week's bucket %v", buckets[:3])
+	}
+}
+
+func TestPickRandomTask(t *testing.T) {
+	setup(t)
+	tasks := []Task{
+		{title: "Low, undated", priority: "3", due: noDueDate, done: "No"},
+		{title: "Done", priority: "1", due: startOfDay(testNow), done: "Yes"},
+		{title: "High, due today", priority: "1", due: startOfDay(testNow), done: "No"},
+	}
+	first, second := rand.New(rand.NewPCG(42, 0)), rand.New(rand.NewPCG(42, 0))
+	counts := map[int]int{}
+	for range 1000 {
+		id := PickRandomTask(tasks, first, true)
+		if again := PickRandomTask(tasks, second, true); again != id {
+			t.Fatalf("same seed picked %d then %d", id, again)
+		}
+		counts[id]++
+	}
+	if counts[1] != 0 {
+		t.Errorf("the done task was picked %d times", counts[1])
+	}
+	// weights are 2 for the low undated task and 6+7 for the high task due today
+	if counts[2] < 4*counts[0] {
+		t.Errorf("weighted picks %v don't favour the urgent task", counts)
+	}
+	counts = map[int]int{}
+	for range 1000 {
+		counts[PickRandomTask(tasks, first, false)]++
+	}
+	if counts[0] < 400 || counts[2] < 400 {
+		t.Errorf("unweighted picks %v aren't even", counts)
+	}
+	if id := PickRandomTask(tasks[1:2], first, true); id != -1 {
+		t.Errorf("picked %d with only done tasks", id)
+	}
+}
+
+func TestSubtasks(t *testing.T) {
+	setup(t)
+	taskList = []Task{{title: "Move house", due: testNow}}
+	captureOutput(t, func() {
+		typeInput("0", "a", "Book van", "a", "Pack | label boxes", "1", "2", "2", "")
+		EditSubtasks()
+	})
+	subs := taskList[0].subtasks
+	if len(subs) != 2 || !subs[0].done || subs[1].done || subs[1].text != "Pack | label boxes" {
+		t.Fatalf("subtasks = %+v", subs)
+	}
+	if done, total := SubtaskProgress(taskList[0]); done != 1 || total != 2 {
+		t.Errorf("SubtaskProgress = %d/%d, want 1/2", done, total)
+	}
+
+	path := filepath.Join(t.TempDir(), "tasks.txt")
+	if err := SaveTasks(path, taskList); err != nil {
+		t.Fatal(err)
+	}
+	tasks, err := LoadTasks(path)
+	if err != nil || len(tasks) != 1 {
+		t.Fatalf("reload = %+v, %v", tasks, err)
+	}
+	want := []Subtask{{text: "Book van", done: true}, {text: "Pack / label boxes"}}
+	if !slices.Equal(tasks[0].subtasks, want) {
+		t.Errorf("reloaded subtasks = %+v, want %+v", tasks[0].subtasks, want)
+	}
+	if DecodeSubtasks("") != nil {
+		t.Error("DecodeSubtasks(\"\") should be nil")
+	}
+}
+
+func TestWarnBusyDay(t *testing.T) {
+	setup(t)
+	config.busyDay = 3
+	day := testNow.AddDate(0, 0, 2)
+	taskList = []Task{{title: "A", due: day, done: "No"}, {title: "B", due: day.Add(time.Hour), done: "No"},
+		{title: "C", due: day, done: "Yes"}, {title: "D", due: testNow, done: "No"}}
+	var warned bool
+	out := captureOutput(t, func() { warned = WarnBusyDay(day, 0) })
+	if warned || out != "" {
+		t.Errorf("2 tasks due, threshold 3: warned = %v, output %q", warned, out)
+	}
+	out = captureOutput(t, func() { warned = WarnBusyDay(day, 1) })
+	if !warned || !strings.Contains(out, "3 tasks are due on "+day.Format("2006-01-02")) {
+		t.Errorf("3 tasks due, threshold 3: warned = %v, output %q", warned, out)
+	}
+	config.busyDay = 0
+	if WarnBusyDay(day, 5) {
+		t.Error("busyDay 0 should never warn")
+	}
+}
+
+func TestConfirmRecurringDone(t *testing.T) {
+	setup(t)
+	config.confirmRepeat = true
+	for _, tc := range []struct {
+		typed, done, repeat string
+	}{
+		{"r", "Yes", "Weekly"},
+		{"s", "Yes", ""},
+		{"", "No", "Weekly"},
+	} {
+		taskList = []Task{{title: "Bins", due: testNow, repeat: "Weekly", repeatFromDone: true, done: "No"}}
+		var message string
+		captureOutput(t, func() {
+			typeInput(tc.typed)
+			message = DoneTaskID(0)
+		})
+		task := taskList[0]
+		if task.done != tc.done || task.repeat != tc.repeat || (message == "") != (tc.done == "No") {
+			t.Errorf("typed %q: done %q, repeat %q, message %q", tc.typed, task.done, task.repeat, message)
+		}
+		if tc.typed == "s" && task.repeatFromDone {
+			t.Error("stopping should clear repeatFromDone")
+		}
+	}
+}
+
+func TestEnterRepeatsLastCommand(t *testing.T) {
+	setup(t)
+	taskList = []Task{{title: "A", due: testNow, done: "No"}, {title: "B", due: testNow, done: "No"}}
+	var s Session
+	captureOutput(t, func() {
+		typeInput("0", "1")
+		if s.RunCommand("") || s.RunCommand("d") || s.RunCommand("") {
+			t.Error("RunCommand quit")
+		}
+	})
+	if s.last != "d" || taskList[0].done != "Yes" || taskList[1].done != "Yes" {
+		t.Errorf("last %q, tasks %+v", s.last, taskList)
+	}
+}
+
+func TestTaskColorPrecedence(t *testing.T) {
+	setup(t)
+	yesterday, later := testNow.AddDate(0, 0, -1), testNow.AddDate(0, 0, 30)
+	for _, tc := range []struct {
+		name string
+		task Task
+		want string
+	}{
+		{"own color", Task{due: later, done: "No", color: "cyan"}, Cyan},
+		{"own color beats today", Task{due: testNow.Add(time.Hour), done: "No", color: "cyan"}, Cyan},
+		{"own color beats done", Task{due: later, done: "Yes", color: "cyan"}, Cyan},
+		{"own color beats doing", Task{due: later, done: "Doing", color: "cyan"}, Cyan},
+		{"overdue beats own color", Task{due: yesterday, done: "No", color: "cyan"}, Red},
+		{"tentative beats own color", Task{due: yesterday, done: "No", color: "cyan", tentative: true}, Dim},
+		{"unknown color ignored", Task{due: later, done: "Yes", color: "plaid"}, Green},
+	} {
+		if got := TaskColor(tc.task, testNow); got != tc.want {
+			t.Errorf("%s: TaskColor = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestDiffSnapshot(t *testing.T) {
+	setup(t)
+	prevAt := testNow.AddDate(0, 0, -3)
+	yesterday := testNow.AddDate(0, 0, -1)
+	prev := []SnapshotEntry{
+		{"Finished", yesterday, "No"},
+		{"Slipped", yesterday, "No"},
+		{"Already late", testNow.AddDate(0, 0, -5), "No"},
+		{"Reopened", yesterday, "Yes"},
+		{"Unchanged", testNow.AddDate(0, 0, 5), "No"},
+	}
+	tasks := []Task{
+		{title: "Finished", due: yesterday, done: "Yes"},
+		{title: "Slipped", due: yesterday, done: "No"},
+		{title: "Already late", due: testNow.AddDate(0, 0, -5), done: "No"},
+		{title: "Reopened", due: yesterday, done: "No"},
+		{title: "Unchanged", due: testNow.AddDate(0, 0, 5), done: "No"},
+		{title: "New", due: noDueDate, done: "No"},
+	}
+	report := DiffSnapshot(prev, prevAt, tasks, testNow)
+	if !slices.Equal(report.added, []string{"New"}) || !slices.Equal(report.completed, []string{"Finished"}) ||
+		!slices.Equal(report.overdue, []string{"Slipped", "Reopened"}) {
+		t.Errorf("report = %+v", report)
+	}
+}
+
+func TestSplitAutoArchive(t *testing.T) {
+	cutoff := startOfDay(testNow).AddDate(0, 0, -7)
+	tasks := []Task{
+		{title: "Old", done: "Yes", completed: cutoff.Add(-time.Minute)},
+		{title: "At cutoff", done: "Yes", completed: cutoff},
+		{title: "Recent", done: "Yes", completed: testNow},
+		{title: "Old repeat", done: "Yes", repeat: "Weekly", completed: cutoff.AddDate(0, 0, -1)},
+		{title: "Never completed", done: "Yes"},
+		{title: "Open", done: "No", completed: cutoff.AddDate(0, 0, -1)},
+	}
+	keep, old := SplitAutoArchive(tasks, 7, testNow)
+	if len(old) != 1 || old[0].title != "Old" || len(keep) != 5 {
+		t.Errorf("keep = %+v, old = %+v", keep, old)
+	}
+}
+
+func TestTagSummaryOverlapping(t *testing.T) {
+	tasks := []Task{
+		{label: "work, urgent", done: "No"},
+		{label: "work", done: "Yes"},
+		{label: "home,urgent", done: "No"},
+		{label: "urgent", done: "Yes"},
+		{label: "", done: "No"},
+	}
+	want := []TagCount{{tag: "urgent", open: 2, done: 1}, {tag: "home", open: 1}, {tag: "work", open: 1, done: 1}}
+	if got := TagSummary(tasks); !slices.Equal(got, want) {
+		t.Errorf("TagSummary = %+v, want %+v", got, want)
+	}
+}
+
+func TestMergeImportedModes(t *testing.T) {
+	setup(t)
+	created := testNow.AddDate(0, -1, 0)
+	list := []Task{{title: "Pay rent", priority: "3", created: created}, {title: "Walk", created: created}}
+	imported := []Task{{title: "pay RENT", priority: "1", given: []string{"title", "priority"}}, {title: "Read"}}
+	for _, tc := range []struct {
+		mode, message string
+		titles        []string
+	}{
+		{"append", "Imported 2 tasks.", []string{"Pay rent", "Walk", "pay RENT", "Read"}},
+		{"replace", "Replaced the list with 2 imported tasks.", []string{"pay RENT", "Read"}},
+		{"merge", "Updated 1 tasks and added 1.", []string{"pay RENT", "Walk", "Read"}},
+	} {
+		result, message := MergeImported(list, imported, tc.mode)
+		var titles []string
+		for _, task := range result {
+			titles = append(titles, task.title)
+		}
+		if message != tc.message || !slices.Equal(titles, tc.titles) {
+			t.Errorf("%s: %q %v, want %q %v", tc.mode, message, titles, tc.message, tc.titles)
+		}
+		if tc.mode == "merge" && (result[0].priority != "1" || !result[0].created.Equal(created)) {
+			t.Errorf("merge kept the old task, or lost when it was created: %+v", result[0])
+		}
+		for _, task := range result {
+			if task.title == "Read" && (!task.created.Equal(testNow) || !task.modified.Equal(testNow)) {
+				t.Errorf("%s: imported task created %v, modified %v; want both now", tc.mode, task.created, task.modified)
+			}
+		}
+	}
+	if list[0].title != "Pay rent" || len(list) != 2 {
+		t.Errorf("MergeImported changed the original list: %+v", list)
+	}
+}
+
+func TestBulkLabel(t *testing.T) {
+	setup(t)
+	fresh := func() []Task {
+		return []Task{{title: "A", label: "work"}, {title: "B", label: "home"}, {title: "C", label: "Work,q4"}}
+	}
+	labels := func() []string {
+		var got []string
+		for _, task := range taskList {
+			got = append(got, task.label)
+		}
+		return got
+	}
+
+	taskList = fresh()
+	captureOutput(t, func() {
+		typeInput("q4", "r", "y", "")
+		BulkLabel("work", Query{})
+	})
+	if want := []string{"q4", "home", "q4"}; !slices.Equal(labels(), want) {
+		t.Errorf("replace: labels = %v, want %v", labels(), want)
+	}
+
+	taskList = fresh()
+	captureOutput(t, func() {
+		typeInput("q4", "a", "y", "")
+		BulkLabel("work", Query{})
+	})
+	if want := []string{"work,q4", "home", "Work,q4"}; !slices.Equal(labels(), want) {
+		t.Errorf("append: labels = %v, want %v", labels(), want)
+	}
+
+	taskList = fresh()
+	captureOutput(t, func() {
+		typeInput("q4", "r", "n")
+		BulkLabel("work", Query{})
+	})
+	if want := []string{"work", "home", "Work,q4"}; !slices.Equal(labels(), want) {
+		t.Errorf("declined: labels = %v, want %v", labels(), want)
+	}
+}
+
+func TestParseRepeatDurations(t *testing.T) {
+	start := time.Date(2026, 1, 31, 9, 0, 0, 0, time.Local)
+	for _, tc := range []struct {
+		input, repeat string
+		next          time.Time
+	}{
+		{"p1d", "Daily", time.Date(2026, 2, 1, 9, 0, 0, 0, time.Local)},
+		{"P2W", "P2W", time.Date(2026, 2, 14, 9, 0, 0, 0, time.Local)},
+		{"P3M", "P3M", time.Date(2026, 5, 1, 9, 0, 0, 0, time.Local)}, // Apr 31 rolls over, as AddDate does
+		{"P1Y", "P1Y", time.Date(2027, 1, 31, 9, 0, 0, 0, time.Local)},
+		{"weekly", "Weekly", time.Date(2026, 2, 7, 9, 0, 0, 0, time.Local)},
+	} {
+		repeat, err := ParseRepeat(tc.input)
+		if err != nil || repeat != tc.repeat {
+			t.Errorf("ParseRepeat(%q) = %q, %v, want %q", tc.input, repeat, err, tc.repeat)
+			continue
+		}
+		if next := advanceDue(start, repeat); !next.Equal(tc.next) {
+			t.Errorf("advanceDue(%s) = %v, want %v", repeat, next, tc.next)
+		}
+	}
+	for _, bad := range []string{"P0D", "P2X", "PD", "P1000D"} {
+		if _, err := ParseRepeat(bad); err == nil {
+			t.Errorf("ParseRepeat(%q) should fail", bad)
+		}
+	}
+	if repeat, err := ParseRepeat("never"); repeat != "" || err != nil {
+		t.Errorf("ParseRepeat(never) = %q, %v, want no repeat", repeat, err)
+	}
+	if next := advanceDue(start, ""); !next.Equal(start) {
+		t.Errorf("advanceDue with no repeat moved the date to %v", next)
+	}
+}
+
+func TestHiddenUntilDone(t *testing.T) {
+	setup(t)
+	taskList = []Task{
+		{title: "Get quotes", due: noDueDate, priority: "3", done: "No"},
+		{title: "Choose builder", due: noDueDate, priority: "3", done: "No", hiddenUntil: "get QUOTES"},
+		{title: "Waiting on nothing", due: noDueDate, priority: "3", done: "No", hiddenUntil: "No such task"},
+	}
+	if !IsHidden(taskList[1], taskList) || IsHidden(taskList[2], taskList) || IsHidden(taskList[0], taskList) {
+		t.Error("only the task waiting on an open task should be hidden")
+	}
+	out := captureOutput(t, func() { ListTasks("", Query{}, false, 0) })
+	if strings.Contains(out, "Choose builder") || !strings.Contains(out, "Waiting on nothing") {
+		t.Errorf("hidden task listed:\n%s", out)
+	}
+
+	taskList[0].done = "Yes"
+	if IsHidden(taskList[1], taskList) {
+		t.Error("task still hidden after the one it waits on was done")
+	}
+	out = captureOutput(t, func() { ListTasks("", Query{}, false, 0) })
+	if !strings.Contains(out, "Choose builder") {
+		t.Errorf("task not revealed:\n%s", out)
+	}
+}
+
+func TestEstimates(t *testing.T) {
+	for _, tc := range []struct {
+		input   string
+		minutes int
+		text    string
+	}{
+		{"", 0, ""},
+		{"45", 45, "45m"},
+		{"2h", 120, "2h"},
+		{"1H30M", 90, "1h30m"},
+		{"90s", 2, "2m"},
+	} {
+		minutes, err := ParseEstimate(tc.input)
+		if err != nil || minutes != tc.minutes || FormatEstimate(minutes) != tc.text {
+			t.Errorf("ParseEstimate(%q) = %d (%q), %v, want %d (%q)", tc.input, minutes, FormatEstimate(minutes), err, tc.minutes, tc.text)
+		}
+	}
+	for _, bad := range []string{"-5", "soon", "-1h"} {
+		if _, err := ParseEstimate(bad); err == nil {
+			t.Errorf("ParseEstimate(%q) should fail", bad)
+		}
+	}
+
+	tasks := []Task{
+		{title: "A", label: "work", done: "No", estimate: 30},
+		{title: "B", label: "work", done: "Doing", estimate: 60},
+		{title: "C", label: "work", done: "No"},
+		{title: "D", label: "work", done: "Yes", estimate: 240},
+		{title: "E", label: "home", done: "No", estimate: 15},
+		{title: "F", label: "work", done: "No", estimate: 45, hiddenUntil: "A"},
+	}
+	if minutes, unestimated := TotalEstimate(tasks, ViewIDs(tasks, "work", Query{}, testNow)); minutes != 90 || unestimated != 1 {
+		t.Errorf("work estimate = %d, %d unestimated, want 90, 1", minutes, unestimated)
+	}
+	if minutes, unestimated := TotalEstimate(tasks, ViewIDs(tasks, "", Query{}, testNow)); minutes != 105 || unestimated != 1 {
+		t.Errorf("total estimate = %d, %d unestimated, want 105, 1", minutes, unestimated)
+	}
+}
+
+func TestLoadCommentsAndBlankLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.txt")
+	content := fileHeader + "\n" +
+		"# Household\n\n" +
+		"Pay rent,2026-11-01,1,Monthly,home,No,\n" +
+		"\n   \n" +
+		"# Garden\n  # ask about the fence\n" +
+		"Mow lawn,,3,,home,No,\"Front first\n\n# then the back\"\n" +
+		"\n# end of file\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tasks, err := LoadTasks(path)
+	if err != nil || len(tasks) != 2 {
+		t.Fatalf("load = %+v, %v", tasks, err)
+	}
+	if !slices.Equal(tasks[0].comments, []string{"# Household"}) ||
+		!slices.Equal(tasks[1].comments, []string{"# Garden", "# ask about the fence", "# end of file"}) {
+		t.Errorf("comments = %q, %q", tasks[0].comments, tasks[1].comments)
+	}
+	if tasks[1].notes != "Front first\n\n# then the back" {
+		t.Errorf("blank and # lines inside a quoted field were dropped: %q", tasks[1].notes)
+	}
+
+	if err := SaveTasks(path, tasks); err != nil {
+		t.Fatal(err)
+	}
+	again, err := LoadTasks(path)
+	if err != nil || len(again) != 2 || !slices.Equal(again[1].comments, tasks[1].comments) || again[1].notes != tasks[1].notes {
+		t.Errorf("reload = %+v, %v", again, err)
+	}
+
+	v1 := filepath.Join(t.TempDir(), "v1.txt")
+	if err := os.WriteFile(v1, []byte("# old file\n\n"+`"Walk","2099-12-31","3","","","No",""`+"\n\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if tasks, err := LoadTasks(v1); err != nil || len(tasks) != 1 || tasks[0].title != "Walk" {
+		t.Errorf("v1 load = %+v, %v", tasks, err)
+	}
+}
+
+func TestOverdueGrace(t *testing.T) {
+	setup(t)
+	config.overdueGrace = 2
+	at := func(day, hour, minute int) time.Time { return time.Date(2026, 10, day, hour, minute, 0, 0, time.Local) }
+	tests := []struct {
+		due, now time.Time
+		overdue  bool
+	}{
+		{at(14, 0, 0), at(16, 23, 59), false}, // date-only, two days of grace still running
+		{at(14, 0, 0), at(17, 0, 0), true},
+		{at(14, 9, 0), at(16, 9, 0), false}, // timed, exactly two days later
+		{at(14, 9, 0), at(16, 9, 1), true},
+	}
+	for _, tt := range tests {
+		if got := IsOverdue(tt.due, tt.now); got != tt.overdue {
+			t.Errorf("grace 2: IsOverdue(%v, %v) = %v, want %v", tt.due, tt.now, got, tt.overdue)
+		}
+	}
+	task := Task{due: at(14, 0, 0), done: "No"}
+	if got := ClassifyTask(task, at(16, 12, 0)); got != UrgencySoon {
+		t.Errorf("task in its grace period classified as %v", got)
+	}
+}
+
+func TestRescheduleLabel(t *testing.T) {
+	setup(t)
+	day := testNow.AddDate(0, 0, 1)
+	taskList = []Task{
+		{title: "Pack", due: day, label: "trip", done: "No"},
+		{title: "Book hotel", due: day, label: "work,Trip", done: "Doing"},
+		{title: "Packed list", due: day, label: "trip", done: "Yes"},
+		{title: "Someday", due: noDueDate, label: "trip", done: "No"},
+		{title: "Report", due: day, label: "work", done: "No"},
+	}
+	out := captureOutput(t, func() {
+		typeInput("trip", "+1w", "")
+		RescheduleLabel()
+	})
+	if !strings.Contains(out, "Rescheduled 2 tasks.") {
+		t.Errorf("output = %q", out)
+	}
+	for i, want := range []time.Time{day.AddDate(0, 0, 7), day.AddDate(0, 0, 7), day, noDueDate, day} {
+		if !taskList[i].due.Equal(want) {
+			t.Errorf("%s: due %v, want %v", taskList[i].title, taskList[i].due, want)
+		}
+	}
+	if !taskList[4].modified.IsZero() || !taskList[3].modified.IsZero() {
+		t.Error("untouched tasks were marked modified")
+	}
+
+	out = captureOutput(t, func() {
+		typeInput("trip", "soon", "")
+		RescheduleLabel()
+	})
+	if !strings.Contains(out, "Invalid offset") || !taskList[0].due.Equal(day.AddDate(0, 0, 7)) {
+		t.Errorf("bad offset: output %q, due %v", out, taskList[0].due)
+	}
+}
+
+func TestImportJSONRejectOrRepair(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.json")
+	if err := os.WriteFile(path, []byte(`[
+		{"title": "Good", "due": "2026-11-01", "priority": 1, "done": true, "repeat": "weekly"},
+		{"title": "Bad fields", "due": "whenever", "priority": "7", "done": "maybe", "repeat": "P0D"},
+		{"priority": 2},
+		{"title": ["Listed"]}
+	]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks, problems, err := ImportJSON(path, false)
+	if err != nil || len(tasks) != 2 || len(problems) != 3 {
+		t.Fatalf("repair: %d tasks, problems %q, %v", len(tasks), problems, err)
+	}
+	if good := tasks[0]; good.priority != "1" || good.done != "Yes" || good.repeat != "Weekly" || FormatDue(good.due) != "2026-11-01" {
+		t.Errorf("good record = %+v", good)
+	}
+	if bad := tasks[1]; bad.priority != "3" || bad.done != "No" || bad.repeat != "" || !isUndated(bad.due) {
+		t.Errorf("repaired record = %+v", bad)
+	}
+	if !strings.HasPrefix(problems[0], "Record 2 repaired: ") || strings.Count(problems[0], ";") != 3 ||
+		problems[1] != "Record 3 rejected: title is missing" ||
+		problems[2] != "Record 4 rejected: title is not text; title is missing" {
+		t.Errorf("repair problems = %q", problems)
+	}
+
+	tasks, problems, err = ImportJSON(path, true)
+	if err != nil || len(tasks) != 1 || tasks[0].title != "Good" || len(problems) != 3 ||
+		!strings.HasPrefix(problems[0], "Record 2 rejected: ") {
+		t.Errorf("strict: tasks %+v, problems %q, %v", tasks, problems, err)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"title": "not a list"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ImportJSON(path, false); err == nil {
+		t.Error("a JSON object rather than a list should fail")
+	}
+}
+
+func TestStatusLineFiltered(t *testing.T) {
+	setup(t)
+	t.Setenv("NO_COLOR", "1")
+	yesterday := testNow.AddDate(0, 0, -1)
+	tasks := []Task{
+		{title: "Late", due: yesterday, priority: "1", label: "work", done: "No"},
+		{title: "Now", due: testNow, priority: "1", label: "work", done: "Doing"},
+		{title: "Shipped", due: yesterday, priority: "1", label: "work", done: "Yes"},
+		{title: "Low", due: yesterday, priority: "3", label: "work", done: "No"},
+		{title: "Home", due: yesterday, priority: "1", label: "home", done: "No"},
+	}
+	query, err := ParseQuery("priority=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := CountTasks(tasks, "work", query, testNow)
+	want := "3 tasks · 1 overdue · 1 today · 1 doing · 1 done · filter: work · query: priority=1"
+	if got := StatusLine(counts, "work", query, false); got != want {
+		t.Errorf("StatusLine = %q, want %q", got, want)
+	}
+
+	counts = CountTasks(tasks, "home", Query{}, testNow)
+	want = "1 tasks · 1 overdue · filter: home"
+	if got := StatusLine(counts, "home", Query{}, true); got != want {
+		t.Errorf("minimal StatusLine = %q, want %q", got, want)
+	}
+}
+
+func TestCleanFolderPath(t *testing.T) {
+	setup(t)
+	tests := []struct{ typed, want string }{
+		{"  /Users/me/Documents/  ", "/Users/me/Documents"},
+		{"/Users/me//Documents/./", "/Users/me/Documents"},
+		{"   ", ""},
+	}
+	if runtime.GOOS == "windows" {
+		tests = append(tests,
+			struct{ typed, want string }{`C:\Users\me\Documents\`, `C:\Users\me\Documents`},
+			struct{ typed, want string }{`C:/Users/me\Documents/`, `C:\Users\me\Documents`})
+	}
+	for _, tt := range tests {
+		want := filepath.FromSlash(tt.want)
+		if got := CleanFolderPath(tt.typed); got != want {
+			t.Errorf("CleanFolderPath(%q) = %q, want %q", tt.typed, got, want)
+		}
+		if tt.want != "" {
+			joined := filepath.Join(CleanFolderPath(tt.typed), "TaskManGo.txt")
+			if joined != filepath.Join(want, "TaskManGo.txt") || strings.Contains(joined, `\/`) || strings.Contains(joined, `/\`) {
+				t.Errorf("joined path %q has mixed or doubled separators", joined)
+			}
+		}
+	}
+
+	folder := t.TempDir()
+	config.folderPath = folder + string(filepath.Separator) + string(filepath.Separator)
+	WriteConfig()
+	config.folderPath = ""
+	if ReadConfig() || config.folderPath != folder {
+		t.Errorf("folder read from an existing config = %q, want %q", config.folderPath, folder)
+	}
+}
+
+func TestAuditEveryChange(t *testing.T) {
+	setup(t)
+	logged := func() []string { // the audit log as "action title" lines since the last call
+		data, _ := os.ReadFile(auditPath())
+		os.Remove(auditPath())
+		var lines []string
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			if fields := strings.SplitN(line, ",", 3); len(fields) == 3 {
+				lines = append(lines, fields[1]+" "+fields[2])
+			}
+		}
+		return lines
+	}
+	check := func(name string, want ...string) {
+		t.Helper()
+		if got := logged(); !slices.Equal(got, want) {
+			t.Errorf("%s logged %q, want %q", name, got, want)
+		}
+	}
+
+	captureOutput(t, func() {
+		taskList = []Task{{title: "Bins", due: testNow, priority: "3", repeat: "Weekly", done: "Yes"}}
+		UpdateRecurringTasks()
+		check("resetting a recurring task", "edit Bins")
+
+		typeInput(append([]string{"Plan trip", ""}, addAnswers...)...)
+		addTask()
+		check("add", "add Plan trip")
+		taskList = taskList[:1]
+		typeInput("Call mum")
+		AddInboxTask()
+		check("inbox", "add Call mum")
+		typeInput("1", "Call dad")
+		EditTaskID(1)
+		check("edit", "edit Call dad")
+		DoneTaskID(1)
+		check("done", "done Call dad")
+		RemoveTaskID(1)
+		check("remove", "remove Call dad")
+
+		typeInput("n", "s")
+		RandomTask()
+		check("random snooze", "edit Bins")
+		typeInput("n", "d")
+		RandomTask()
+		check("random done", "done Bins")
+
+		taskList = []Task{{title: "A", done: "No"}, {title: "B", done: "No", tentative: true}}
+		MarkAllDone(taskList, "", Query{})
+		check("mark all done", "done A")
+
+		taskList = []Task{{title: "Dup", due: noDueDate, done: "No"}, {title: "dup", due: noDueDate, done: "No"}}
+		typeInput("y", "")
+		MergeDuplicateTasks()
+		check("merge duplicates", "remove dup", "edit Dup")
+
+		RunBatch([]string{"add", "Batch", "done", "1", "remove", "0"}, "")
+		check("batch", "add Batch", "done Batch", "remove Dup")
+
+		taskList = []Task{{title: "Plan", badDue: "2026/10/21", priority: "3", label: "trip", done: "No"}}
+		typeInput("0", "a", "Book", "1", "")
+		EditSubtasks()
+		check("subtasks", "edit Plan", "edit Plan")
+		typeInput("urgent", "a", "y", "")
+		BulkLabel("", Query{})
+		check("bulk label", "edit Plan")
+		typeInput("0")
+		s := &Session{}
+		s.RunCommand("up")
+		s.RunCommand(".")
+		check("priority and repeat", "edit Plan", "edit Plan")
+		typeInput("")
+		FixDates()
+		check("fix dates", "edit Plan")
+		typeInput("trip", "+1d", "")
+		RescheduleLabel()
+		check("reschedule label", "edit Plan")
+
+		typeInput("n", "0", "")
+		Templates()
+		typeInput("u", "0", "")
+		Templates()
+		check("template", "add Plan")
+
+		taskList = []Task{{title: "Old", due: noDueDate, done: "Yes", completed: testNow.AddDate(0, 0, -30)}}
+		typeInput("y")
+		ArchiveDone()
+		check("archive", "remove Old")
+		config.autoArchive = 7
+		taskList = []Task{{title: "Older", due: noDueDate, done: "Yes", completed: testNow.AddDate(0, 0, -30)}}
+		typeInput("")
+		AutoArchive()
+		check("auto archive", "remove Older")
+		typeInput("0")
+		RestoreFromArchive()
+		check("restore", "add Old")
+
+		path := filepath.Join(t.TempDir(), "import.csv")
+		os.WriteFile(path, []byte("title,priority\nOld,1\nNew,2\n"), 0644)
+		typeInput(path, "m", "")
+		ImportTasks()
+		check("import merge", "edit Old", "add New")
+		typeInput(path, "a", "")
+		ImportTasks()
+		check("import append", "add Old", "add New")
+		taskList = []Task{{title: "Gone", due: noDueDate, done: "No"}}
+		typeInput(path, "r", "y", "")
+		ImportTasks()
+		check("import replace", "remove Gone", "add Old", "add New")
+	})
+}
+
+func TestBlankDueDate(t *testing.T) {
+	setup(t)
+	current := testNow.AddDate(0, 0, 4)
+	var due time.Time
+	captureOutput(t, func() {
+		typeInput("")
+		due = inputDueDate()
+	})
+	if !isUndated(due) {
+		t.Errorf("blank when adding = %v, want no due date", due)
+	}
+	captureOutput(t, func() {
+		typeInput("")
+		due = inputNewDueDate(current)
+	})
+	if !due.Equal(current) {
+		t.Errorf("blank when editing = %v, want %v kept", due, current)
+	}
+	captureOutput(t, func() {
+		typeInput("-")
+		due = inputNewDueDate(current)
+	})
+	if !isUndated(due) {
+		t.Errorf("- when editing = %v, want no due date", due)
+	}
+
+	config.explicitNoDue = true
+	out := captureOutput(t, func() {
+		typeInput("", "none")
+		due = inputDueDate()
+	})
+	if !isUndated(due) || !strings.Contains(out, "Type none for no due date!") {
+		t.Errorf("explicitNoDue: due %v, output %q", due, out)
+	}
+	captureOutput(t, func() {
+		typeInput("")
+		due = inputNewDueDate(current)
+	})
+	if !due.Equal(current) {
+		t.Errorf("explicitNoDue shouldn't change editing: due %v", due)
+	}
+
+	config.explicitNoDue, config.requireDueDate = false, true
+	out = captureOutput(t, func() {
+		typeInput("", "someday", "2026-10-20")
+		due = inputDueDate()
+	})
+	if FormatDue(due) != "2026-10-20" || !strings.Contains(out, "A due date is required!") || !strings.Contains(out, "Invalid date!") {
+		t.Errorf("requireDueDate: due %v, output %q", due, out)
+	}
+	out = captureOutput(t, func() {
+		typeInput("", "2026-10-21")
+		due = inputNewDueDate(noDueDate)
+	})
+	if FormatDue(due) != "2026-10-21" || !strings.Contains(out, "A due date is required!") {
+		t.Errorf("requireDueDate when editing an undated task: due %v, output %q", due, out)
+	}
+}
+
+func TestStatsOverlayKeepsFilter(t *testing.T) {
+	setup(t)
+	taskList = []Task{
+		{title: "Report", due: testNow.AddDate(0, 0, -1), priority: "1", label: "work", done: "No"},
+		{title: "Garden", due: noDueDate, priority: "3", label: "home", done: "No"},
+	}
+	query, _ := ParseQuery("priority=1")
+	s := &Session{label: "work", query: query}
+	captureOutput(t, func() { s.RunCommand("?s") })
+	if s.label != "work" || s.query.text != "priority=1" {
+		t.Fatalf("?s changed the view to label %q, query %q", s.label, s.query.text)
+	}
+	if !strings.Contains(s.overlay, "Tasks: 2 (2 open, 0 in progress, 0 done)") || !strings.Contains(s.overlay, "Overdue: 1") {
+		t.Errorf("overlay doesn't cover the whole list:\n%s", s.overlay)
+	}
+
+	out := captureOutput(t, func() { // as the main loop shows the next screen
+		ListTasks(s.label, s.query, s.grouped, s.top)
+		fmt.Println(s.overlay)
+	})
+	if !strings.Contains(out, "Report") || strings.Contains(out, "Garden") || !strings.Contains(out, "----- Stats -----") {
+		t.Errorf("screen after ?s:\n%s", out)
+	}
+}
+
+func TestMergeTaskLists(t *testing.T) {
+	created := testNow.AddDate(0, -1, 0)
+	older, newer := testNow.AddDate(0, 0, -2), testNow.AddDate(0, 0, -1)
+	a := []Task{
+		{title: "Shared", created: created, priority: "1", modified: older},
+		{title: "Edited in b", created: created, priority: "3", modified: older},
+		{title: "Edited in a", created: created, priority: "1", modified: newer},
+		{title: "Only in a", created: created},
+	}
+	b := []Task{
+		{title: "Only in b", created: created},
+		{title: "edited in A", created: created, priority: "2", modified: older}, // titles match ignoring case
+		{title: "Edited in b", created: created, priority: "2", modified: newer},
+		{title: "Shared", created: created, priority: "1", modified: older},
+		{title: "Shared", created: testNow}, // created at a different time, so a different task
+	}
+	merged, conflicts := MergeTaskLists(a, b)
+	var got []string
+	for _, task := range merged {
+		got = append(got, task.title+" "+task.priority)
+	}
+	want := []string{"Shared 1", "Edited in b 2", "Edited in a 1", "Only in a ", "Only in b ", "Shared "}
+	if conflicts != 2 || !slices.Equal(got, want) {
+		t.Errorf("merged %q with %d conflicts, want %q with 2", got, conflicts, want)
+	}
+}
+
+func TestChangesMarkModified(t *testing.T) {
+	setup(t)
+	taskList = []Task{{title: "Bins", due: testNow, priority: "3", repeat: "Weekly", done: "Yes"}}
+	UpdateRecurringTasks()
+	if !taskList[0].modified.Equal(testNow) {
+		t.Errorf("recurring reset left modified at %v", taskList[0].modified)
+	}
+
+	for _, typed := range []string{"s", "d"} {
+		taskList[0].modified = time.Time{}
+		captureOutput(t, func() {
+			typeInput("n", typed)
+			RandomTask()
+		})
+		if !taskList[0].modified.Equal(testNow) {
+			t.Errorf("random pick %q left modified at %v", typed, taskList[0].modified)
+		}
+	}
+
+	task := Task{done: "No"}
+	setDone(&task, "Doing")
+	if !task.modified.Equal(testNow) || !task.completed.IsZero() {
+		t.Errorf("setDone(Doing) = %+v", task)
+	}
+}
+
+func TestDoingRoundTrip(t *testing.T) {
+	setup(t)
+	t.Setenv("NO_COLOR", "")
+	taskList = []Task{{title: "Paint fence", due: testNow.AddDate(0, 0, 5), priority: "3", done: "No"}}
+	for _, step := range []struct{ typed, want string }{{"d", "Doing"}, {"n", "No"}, {"doing", "Doing"}, {"y", "Yes"}} {
+		captureOutput(t, func() {
+			typeInput("6", step.typed)
+			EditTaskID(0)
+		})
+		if err := SaveTasks(config.filePath, taskList); err != nil {
+			t.Fatal(err)
+		}
+		tasks, err := LoadTasks(config.filePath)
+		if err != nil || len(tasks) != 1 || tasks[0].done != step.want {
+			t.Errorf("typed %q: reloaded %+v, %v, want done %q", step.typed, tasks, err, step.want)
+		}
+		taskList = tasks
+	}
+
+	doing := Task{due: testNow.AddDate(0, 0, 5), done: "Doing"}
+	if got := TaskColor(doing, testNow); got != Yellow {
+		t.Errorf("Doing colored %q, want yellow", got)
+	}
+	doing.due = testNow.AddDate(0, 0, -1)
+	if got := TaskColor(doing, testNow); got != Red {
+		t.Errorf("overdue Doing colored %q, want red", got)
+	}
+	out := captureOutput(t, func() { PrintTask(0, Task{title: "Busy", due: noDueDate, priority: "3", done: "Doing"}) })
+	if !strings.Contains(out, Yellow) {
+		t.Errorf("Doing row isn't yellow: %q", out)
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	setup(t)
+	tasks := []Task{
+		{title: "Rent", due: time.Date(2026, 10, 15, 0, 0, 0, 0, time.Local), priority: "1", label: "home", done: "No"},
+		{title: "Report", due: testNow, priority: "2", label: "work,urgent", done: "Doing"},
+		{title: "Slides", due: time.Date(2026, 10, 20, 0, 0, 0, 0, time.Local), priority: "3", label: "work", done: "Yes"},
+		{title: "Someday", due: noDueDate, priority: "3", label: "", done: "No"},
+	}
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"Rent", "Report", "Slides", "Someday"}},
+		{"priority<=2", []string{"Rent", "Report"}},
+		{"priority = critical", []string{"Rent"}},
+		{"done=no", []string{"Rent", "Someday"}},
+		{"done != Yes and label=work", []string{"Report"}},
+		{"label=urgent or priority=1", []string{"Rent", "Report"}},
+		{"label=home or label=work and done=Yes", []string{"Rent", "Slides"}}, // and binds tighter
+		{"due<today", []string{"Rent"}},
+		{"due>=2026-10-16 and due<=tuesday", []string{"Report", "Slides"}},
+		{"due=none", []string{"Someday"}},
+		{"due=20 oct", []string{"Slides"}},
+	}
+	for _, tt := range tests {
+		query, err := ParseQuery(tt.query)
+		if err != nil {
+			t.Errorf("ParseQuery(%q): %v", tt.query, err)
+			continue
+		}
+		var got []string
+		for _, task := range tasks {
+			if query.Match(task, testNow) {
+				got = append(got, task.title)
+			}
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%q matched %q, want %q", tt.query, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"done=maybe", "done<No", "size=3", "priority", "priority=", "priority=9", "due=whenever",
+		"and priority=1", "label=work or"} {
+		if _, err := ParseQuery(bad); err == nil {
+			t.Errorf("ParseQuery(%q) should fail", bad)
+		}
+	}
+}
+
+func TestNotifyDue(t *testing.T) {
+	setup(t)
+	t.Setenv("NO_COLOR", "1")
+	saved := runNotify
+	t.Cleanup(func() { runNotify = saved })
+	var ran [][]string
+	runNotify = func(args []string) error {
+		ran = append(ran, args)
+		return nil
+	}
+	taskList = []Task{
+		{title: "Call bank", due: testNow.Add(3 * time.Hour), done: "No"},
+		{title: "Pay rent", due: testNow.AddDate(0, 0, -1), done: "No"},
+		{title: "Filed", due: testNow.AddDate(0, 0, -1), done: "Yes"},
+		{title: "Maybe", due: testNow.AddDate(0, 0, -1), done: "No", tentative: true},
+		{title: "Later", due: testNow.AddDate(0, 0, 3), done: "No"},
+	}
+	want := "*** 1 due today, 1 overdue: Pay rent, Call bank ***"
+	if got := DueBanner(taskList, testNow); got != want {
+		t.Errorf("DueBanner = %q, want %q", got, want)
+	}
+
+	for _, tc := range []struct {
+		notify string
+		banner bool
+		runs   int
+	}{{"Off", false, 0}, {"Bell", true, 0}, {"Desktop", true, 1}} {
+		config.notify, ran = tc.notify, nil
+		var banner string
+		captureOutput(t, func() { banner = NotifyDue() })
+		if (banner == want) != tc.banner || len(ran) != tc.runs {
+			t.Errorf("notify %s: banner %q, ran %q", tc.notify, banner, ran)
+		}
+	}
+	if args := NotifyArgs(runtime.GOOS, "1 tasks due today, 1 overdue"); args != nil && !slices.Equal(ran[0], args) {
+		t.Errorf("desktop notification ran %q, want %q", ran[0], args)
+	}
+
+	config.notify, ran = "Desktop", nil
+	taskList = taskList[2:3]
+	if banner := NotifyDue(); banner != "" || len(ran) != 0 {
+		t.Errorf("nothing due: banner %q, ran %q", banner, ran)
+	}
+}
+
+func TestNotifyArgs(t *testing.T) {
+	tests := []struct {
+		goos string
+		want []string
+	}{
+		{"linux", []string{"notify-send", "TaskManGo", `2 "due"`}},
+		{"freebsd", []string{"notify-send", "TaskManGo", `2 "due"`}},
+		{"darwin", []string{"osascript", "-e", `display notification "2 \"due\"" with title "TaskManGo"`}},
+		{"windows", []string{"msg", "*", `TaskManGo: 2 "due"`}},
+		{"plan9", nil},
+	}
+	for _, tt := range tests {
+		if got := NotifyArgs(tt.goos, `2 "due"`); !slices.Equal(got, tt.want) {
+			t.Errorf("NotifyArgs(%s) = %q, want %q", tt.goos, got, tt.want)
+		}
+	}
+}
+
+func TestInputInt(t *testing.T) {
+	setup(t)
+	tests := []struct {
+		typed string
+		want  int
+		ok    bool
+	}{
+		{"0", 0, true},
+		{" 7 ", 7, true},
+		{"3", 3, true},
+		{"8", 0, false},
+		{"-1", 0, false},
+		{"two", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		var got int
+		var ok bool
+		out := captureOutput(t, func() {
+			typeInput(tt.typed)
+			got, ok = inputInt("ID: ", 0, 7)
+		})
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("inputInt(%q) = %d, %v, want %d, %v", tt.typed, got, ok, tt.want, tt.ok)
+		}
+		if !ok && !strings.Contains(out, "Number out of range (0 to 7).") {
+			t.Errorf("inputInt(%q) printed %q", tt.typed, out)
+		}
+	}
+}
+
+func TestStreak(t *testing.T) {
+	day := func(d int, hour int) time.Time { return time.Date(2026, 10, d, hour, 0, 0, 0, time.Local) }
+	tests := []struct {
+		name   string
+		dates  []time.Time
+		repeat string
+		want   int
+	}{
+		{"none", nil, "Daily", 0},
+		{"one", []time.Time{day(16, 9)}, "Daily", 1},
+		{"daily unbroken", []time.Time{day(14, 8), day(16, 21), day(15, 7)}, "Daily", 3},
+		{"twice in a day", []time.Time{day(15, 8), day(15, 20), day(16, 9)}, "Daily", 2},
+		{"daily gap", []time.Time{day(16, 9), day(15, 9), day(13, 9), day(12, 9)}, "Daily", 2},
+		{"weekly, a day late", []time.Time{day(1, 9), day(8, 9), day(16, 9)}, "Weekly", 1},
+		{"weekly, early", []time.Time{day(1, 9), day(7, 9), day(14, 9)}, "Weekly", 3},
+		{"every 2 weeks", []time.Time{day(2, 9), day(16, 9)}, "P2W", 2},
+	}
+	for _, tt := range tests {
+		if got := Streak(tt.dates, tt.repeat); got != tt.want {
+			t.Errorf("%s: Streak = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGroupByLabel(t *testing.T) {
+	setup(t)
+	taskList = []Task{
+		{title: "Loose end", due: noDueDate, priority: "3", done: "No"},
+		{title: "Report", due: noDueDate, priority: "3", label: "work", done: "No"},
+		{title: "Taxes", due: noDueDate, priority: "3", label: "work, home", done: "No"},
+		{title: "Garden", due: noDueDate, priority: "3", label: "home", done: "No"},
+	}
+	groups := GroupByLabel(taskList, []int{0, 1, 2, 3})
+	var got []string
+	for _, group := range groups {
+		got = append(got, fmt.Sprint(group.label, group.ids))
+	}
+	if want := []string{"home[2 3]", "work[1 2]", "(no label)[0]"}; !slices.Equal(got, want) {
+		t.Errorf("groups = %q, want %q", got, want)
+	}
+
+	out := captureOutput(t, func() { ListTasks("", Query{}, true, 0) })
+	order := []string{"== home ==", "Taxes", "Garden", "== work ==", "Report", "Taxes", "== (no label) ==", "Loose end"}
+	rest := out
+	for _, text := range order {
+		i := strings.Index(rest, text)
+		if i < 0 {
+			t.Fatalf("%q missing or out of order in:\n%s", text, out)
+		}
+		rest = rest[i+len(text):]
+	}
+
+	out = captureOutput(t, func() { ListTasks("home", Query{}, true, 0) })
+	if !strings.Contains(out, "== work ==") || strings.Contains(out, "(no label)") || strings.Contains(out, "Report") {
+		t.Errorf("grouped list filtered by home:\n%s", out)
+	}
+}
+
+func TestExportSnapshot(t *testing.T) {
+	setup(t)
+	saved := []Task{
+		{title: "Pay rent", due: time.Date(2026, 11, 1, 0, 0, 0, 0, time.Local), priority: "1", label: "home", done: "No"},
+		{title: "Walk", due: noDueDate, priority: "3", done: "Yes"},
+	}
+	if err := SaveTasks(config.filePath, saved); err != nil {
+		t.Fatal(err)
+	}
+	taskList = []Task{{title: "Unsaved", due: noDueDate, priority: "3", done: "No"}}
+	devNull, _ := os.Open(os.DevNull)
+	defer devNull.Close()
+	savedStderr := os.Stderr
+	os.Stderr = devNull // usage and error messages
+	t.Cleanup(func() { os.Stderr = savedStderr })
+
+	dir := t.TempDir()
+	tests := []struct {
+		args []string
+		code int
+		file string
+		want string // in the exported file
+	}{
+		{[]string{"tasks.json"}, 0, "tasks.json", `"title": "Pay rent"`},
+		{[]string{"tasks.csv"}, 0, "tasks.csv", "Pay rent,2026-11-01,1,,home,No"},
+		{[]string{"tasks.out", "--format", "TEXT"}, 0, "tasks.out", "Pay rent"},
+		{[]string{"--format", "json", "list.txt"}, 0, "list.txt", `"title": "Walk"`},
+		{[]string{"tasks.xml", "--format", "xml"}, 1, "", ""},
+		{[]string{"a.csv", "b.csv"}, 2, "", ""},
+		{nil, 2, "", ""},
+	}
+	for _, tt := range tests {
+		args := slices.Clone(tt.args)
+		for i, arg := range args {
+			if !strings.HasPrefix(arg, "--") && (i == 0 || args[i-1] != "--format") {
+				args[i] = filepath.Join(dir, arg)
+			}
+		}
+		args = append(args, "--data", config.filePath)
+		var code int
+		captureOutput(t, func() { code = RunExport(args) })
+		if code != tt.code {
+			t.Errorf("export %q exited %d, want %d", tt.args, code, tt.code)
+			continue
+		}
+		if tt.file == "" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, tt.file))
+		if err != nil || !strings.Contains(string(data), tt.want) || strings.Contains(string(data), "Unsaved") {
+			t.Errorf("export %q wrote %v:\n%s", tt.args, err, data)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.csv")); err == nil {
+		t.Error("export with two files wrote one anyway")
+	}
+	if len(taskList) != 1 || taskList[0].title != "Unsaved" {
+		t.Errorf("export changed taskList: %+v", taskList)
+	}
+
+	out := filepath.Join(dir, "from-config.csv")
+	if code := RunExport([]string{out}); code != 2 {
+		t.Errorf("export without a config or --data exited %d, want 2", code)
+	}
+	WriteConfig()
+	config.filePath = ""
+	var code int
+	captureOutput(t, func() { code = RunExport([]string{out}) })
+	if data, _ := os.ReadFile(out); code != 0 || !strings.Contains(string(data), "Pay rent") {
+		t.Errorf("export using the config's data file exited %d, wrote:\n%s", code, data)
+	}
+}
+
+func TestDoneMarkerStyles(t *testing.T) {
+	setup(t)
+	t.Setenv("COLUMNS", "120")
+	t.Setenv("NO_COLOR", "1")
+	taskList = []Task{
+		{title: "Open", due: noDueDate, priority: "3", done: "No"},
+		{title: "Started", due: noDueDate, priority: "3", done: "Doing"},
+		{title: "Finished", due: noDueDate, priority: "3", done: "Yes"},
+	}
+	for name, markers := range doneMarkerStyles {
+		config.doneMarkers = name
+		out := captureOutput(t, func() { ListTasks("", Query{}, false, 0) })
+		for i, marker := range []string{markers.no, markers.doing, markers.yes} {
+			line := out[strings.Index(out, taskList[i].title):]
+			line = line[:strings.Index(line, "\n")]
+			if !strings.Contains(line, marker) {
+				t.Errorf("%s: row %q doesn't show %q", name, line, marker)
+			}
+		}
+		if !strings.Contains(out, markers.header) {
+			t.Errorf("%s: header %q missing:\n%s", name, markers.header, out)
+		}
+
+		if err := SaveTasks(config.filePath, taskList); err != nil {
+			t.Fatal(err)
+		}
+		tasks, err := LoadTasks(config.filePath)
+		if err != nil || tasks[0].done != "No" || tasks[1].done != "Doing" || tasks[2].done != "Yes" {
+			t.Errorf("%s: saved done values changed: %+v, %v", name, tasks, err)
+		}
+	}
+	config.doneMarkers = "unknown"
+	if DoneMarker("Yes") != "Yes" {
+		t.Error("an unknown style should show words")
+	}
+}
+
+func TestOldestOpen(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 10, d, 0, 0, 0, 0, time.Local) }
+	tasks := []Task{
+		{title: "Created 10th", created: day(10), due: day(1), done: "No"},
+		{title: "Old, done", created: day(1), done: "Yes"},
+		{title: "No created, due 5th", due: day(5), done: "Doing"},
+		{title: "Created 3rd", created: day(3), due: day(30), done: "No"},
+		{title: "Created 10th too", created: day(10), done: "No"},
+		{title: "No created or due", due: noDueDate, done: "No"},
+	}
+	got := OldestOpen(tasks, 10)
+	if want := []int{3, 2, 0, 4, 5}; !slices.Equal(got, want) {
+		t.Errorf("OldestOpen = %v, want %v", got, want)
+	}
+	if got := OldestOpen(tasks, 2); !slices.Equal(got, []int{3, 2}) {
+		t.Errorf("OldestOpen(2) = %v, want [3 2]", got)
+	}
+	if got := OldestOpen(tasks[1:2], 5); len(got) != 0 {
+		t.Errorf("only done tasks gave %v", got)
+	}
+}
+
+func TestShortcutCommands(t *testing.T) {
+	setup(t)
+	for i := range 4 {
+		taskList = append(taskList, Task{title: fmt.Sprintf("Task %d", i), due: noDueDate, priority: "3", done: "No"})
+	}
+	s := &Session{}
+	out := captureOutput(t, func() {
+		typeInput("1", "Renamed")
+		s.RunCommand("e3")
+	})
+	if taskList[3].title != "Renamed" || !strings.Contains(out, "1 Title: Task 3") || s.last != "e" {
+		t.Errorf("e3 edited %+v, last %q:\n%s", taskList, s.last, out)
+	}
+
+	captureOutput(t, func() { s.RunCommand("d0") })
+	if taskList[0].done != "Yes" {
+		t.Error("d0 didn't mark task 0 done")
+	}
+	captureOutput(t, func() { s.RunCommand("r1") })
+	if len(taskList) != 3 || taskList[1].title != "Task 2" {
+		t.Errorf("r1 left %+v", taskList)
+	}
+
+	out = captureOutput(t, func() {
+		typeInput("")
+		s.RunCommand("e3")
+	})
+	if !strings.Contains(out, "Invalid task ID!") || strings.Contains(out, "Edit task") {
+		t.Errorf("e3 with 3 tasks:\n%s", out)
+	}
+
+	for _, choice := range []string{"e", "x3", "e3a", "e-1", "e99999999999999999999"} {
+		if _, _, ok := ParseShortcut(choice); ok {
+			t.Errorf("ParseShortcut(%q) should not be a shortcut", choice)
+		}
+	}
+}
+
+func TestSaveAs(t *testing.T) {
+	setup(t)
+	WriteConfig()
+	configBefore, _ := os.ReadFile(configPath())
+	filePath := config.filePath
+	taskList = []Task{{title: "Share me", due: noDueDate, priority: "3", done: "No"}}
+	path := filepath.Join(t.TempDir(), "copy.txt")
+	out := captureOutput(t, func() {
+		typeInput(path, "")
+		SaveAs()
+	})
+	tasks, err := LoadTasks(path)
+	if err != nil || len(tasks) != 1 || tasks[0].title != "Share me" || !strings.Contains(out, "Tasks saved to: "+path) {
+		t.Errorf("copy = %+v, %v:\n%s", tasks, err, out)
+	}
+	configAfter, _ := os.ReadFile(configPath())
+	if config.filePath != filePath || string(configAfter) != string(configBefore) {
+		t.Errorf("saving a copy changed the data file path to %q", config.filePath)
+	}
+	if _, err := os.Stat(filePath); err == nil {
+		t.Error("saving a copy wrote the data file")
+	}
+
+	missing := filepath.Join(t.TempDir(), "no such folder", "copy.txt")
+	out = captureOutput(t, func() {
+		typeInput(missing, "")
+		SaveAs()
+	})
+	if !strings.Contains(out, "Error: folder") {
+		t.Errorf("saving into a missing folder printed:\n%s", out)
+	}
+}
+
+func TestTentativeNotDue(t *testing.T) {
+	setup(t)
+	t.Setenv("NO_COLOR", "1")
+	taskList = []Task{
+		{title: "Learn piano", due: testNow.AddDate(0, 0, -2), priority: "3", done: "No", tentative: true},
+		{title: "Visit Rome", due: testNow.AddDate(0, 0, 1), priority: "3", done: "No", tentative: true},
+		{title: "Dentist", due: testNow.AddDate(0, 0, 1), priority: "3", done: "No"},
+		{title: "Bills", due: testNow.AddDate(0, 0, -1), priority: "3", done: "No"},
+	}
+	soon := DueSoon(taskList, testNow)
+	if len(soon) != 1 || soon[0].title != "Dentist" {
+		t.Errorf("DueSoon = %+v, want only Dentist", soon)
+	}
+	counts := CountTasks(taskList, "", Query{}, testNow)
+	if counts.total != 4 || counts.overdue != 1 {
+		t.Errorf("counts = %+v, want 4 tasks, 1 overdue", counts)
+	}
+	if banner := DueBanner(taskList, testNow); strings.Contains(banner, "Learn piano") {
+		t.Errorf("banner = %q", banner)
+	}
+	out := captureOutput(t, func() { ListTasks("", Query{}, false, 0) })
+	if !strings.Contains(out, "Learn piano") || !strings.Contains(out, "Visit Rome") {
+		t.Errorf("tentative tasks not listed:\n%s", out)
+	}
+	if buckets := DueHistogram(taskList, testNow); buckets[0].count != 1 {
+		t.Errorf("histogram overdue = %d, want 1", buckets[0].count)
+	}
+	if stats := Stats(taskList, testNow); !strings.Contains(stats, "Overdue: 1 ") || !strings.Contains(stats, "Due this week: 1\n") {
+		t.Errorf("stats count tentative tasks:\n%s", stats)
+	}
+	var prev []SnapshotEntry
+	for _, task := range taskList {
+		prev = append(prev, SnapshotEntry{title: task.title, due: task.due, done: "Yes"})
+	}
+	if report := DiffSnapshot(prev, testNow.AddDate(0, 0, -3), taskList, testNow); !slices.Equal(report.overdue, []string{"Bills"}) {
+		t.Errorf("now overdue = %v, want only Bills", report.overdue)
+	}
+}
+
+func TestMarkAllDoneInView(t *testing.T) {
+	setup(t)
+	taskList = []Task{
+		{title: "Report", due: noDueDate, priority: "1", label: "work", done: "No"},
+		{title: "Email", due: noDueDate, priority: "3", label: "work", done: "No"},
+		{title: "Review", due: noDueDate, priority: "1", label: "work", done: "No", hiddenUntil: "Report"},
+		{title: "Plan", due: noDueDate, priority: "1", label: "work", done: "No", tentative: true},
+		{title: "Shop", due: noDueDate, priority: "1", label: "home", done: "No"},
+	}
+	query, err := ParseQuery("priority = 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := MarkAllDone(taskList, "work", query); n != 1 {
+		t.Errorf("marked %d tasks done, want 1", n)
+	}
+	var done []string
+	for _, task := range taskList {
+		if task.done == "Yes" {
+			done = append(done, task.title)
+		}
+	}
+	if !slices.Equal(done, []string{"Report"}) {
+		t.Errorf("done = %v, want only Report, the one task on screen", done)
+	}
+}
+
+func TestClassifyTask(t *testing.T) {
+	setup(t)
+	t.Setenv("NO_COLOR", "1")
+	tests := []struct {
+		name string
+		task Task
+		want Urgency
+	}{
+		{"undated", Task{due: noDueDate, done: "No"}, UrgencyUndated},
+		{"overdue", Task{due: testNow.AddDate(0, 0, -1), done: "No"}, UrgencyOverdue},
+		{"timed, an hour ago", Task{due: testNow.Add(-time.Hour), done: "Doing"}, UrgencyOverdue},
+		{"today", Task{due: startOfDay(testNow), done: "No"}, UrgencyToday},
+		{"timed, later today", Task{due: testNow.Add(time.Hour), done: "No"}, UrgencyToday},
+		{"tomorrow", Task{due: testNow.AddDate(0, 0, 1), done: "No"}, UrgencySoon},
+		{"last day of soon", Task{due: testNow.AddDate(0, 0, 3), done: "No"}, UrgencySoon},
+		{"later", Task{due: testNow.AddDate(0, 0, 4), done: "No"}, UrgencyLater},
+		{"done and overdue", Task{due: testNow.AddDate(0, 0, -1), done: "Yes"}, UrgencyDone},
+		{"tentative and overdue", Task{due: testNow.AddDate(0, 0, -1), done: "No", tentative: true}, UrgencyTentative},
+	}
+	colors := map[Urgency]string{UrgencyOverdue: Red, UrgencyToday: Blue, UrgencyTentative: Dim, UrgencyDone: Green}
+	for _, tt := range tests {
+		task := tt.task
+		task.title, task.priority = tt.name, "3"
+		got := ClassifyTask(task, testNow)
+		if got != tt.want {
+			t.Errorf("%s: ClassifyTask = %v, want %v", tt.name, got, tt.want)
+		}
+		if want := colors[got]; task.done != "Doing" && TaskColor(task, testNow) != want {
+			t.Errorf("%s: TaskColor = %q, want %q", tt.name, TaskColor(task, testNow), want)
+		}
+		dueSoon := len(DueSoon([]Task{task}, testNow)) == 1
+		if dueSoon != (got == UrgencyToday || got == UrgencySoon) {
+			t.Errorf("%s: in DueSoon = %v for %v", tt.name, dueSoon, got)
+		}
+		counts := CountTasks([]Task{task}, "", Query{}, testNow)
+		if (counts.overdue == 1) != (got == UrgencyOverdue) || (counts.today == 1) != (got == UrgencyToday) ||
+			(counts.done == 1) != (got == UrgencyDone) {
+			t.Errorf("%s: counts %+v for %v", tt.name, counts, got)
+		}
+		inBanner := DueBanner([]Task{task}, testNow) != ""
+		if inBanner != (got == UrgencyOverdue || got == UrgencyToday) {
+			t.Errorf("%s: in banner = %v for %v", tt.name, inBanner, got)
+		}
+	}
+}
+
+func TestRunHeadless(t *testing.T) {
+	setup(t)
+	devNull, _ := os.Open(os.DevNull)
+	defer devNull.Close()
+	savedStderr := os.Stderr
+	os.Stderr = devNull
+	t.Cleanup(func() { os.Stderr = savedStderr })
+	typeInput() // nothing to read, so any prompt gets no answer
+
+	var code int
+	out := captureOutput(t, func() { code = RunHeadless([]string{"add", "Milk"}, "") })
+	if code != 2 || strings.Contains(out, "Enter path") {
+		t.Errorf("without a config: exit %d, output %q", code, out)
+	}
+	if _, err := os.Stat(configPath()); err == nil {
+		t.Error("a headless run created a config file")
+	}
+
+	WriteConfig()
+	out = captureOutput(t, func() { code = RunHeadless([]string{"add", "Milk", "add", "Eggs", "done", "0"}, "") })
+	if code != 0 || !strings.Contains(out, "added 2, completed 1, removed 0\n") {
+		t.Errorf("all succeeded: exit %d, output %q", code, out)
+	}
+	out = captureOutput(t, func() { code = RunHeadless([]string{"remove", "1", "done", "9", "frobnicate", "x"}, "") })
+	if code != 1 || !strings.Contains(out, "added 0, completed 0, removed 1, 2 failed\n") {
+		t.Errorf("mixed: exit %d, output %q", code, out)
+	}
+	tasks, _ := LoadTasks(config.filePath)
+	if len(tasks) != 1 {
+		t.Errorf("saved %+v, want one task left", tasks)
+	}
+}
+
+func TestRepeatBumpAfterSort(t *testing.T) {
+	setup(t)
+	taskList = []Task{
+		{title: "A", due: noDueDate, priority: "1", done: "No", created: testNow.Add(-3 * time.Hour)},
+		{title: "B", due: noDueDate, priority: "1", done: "No", created: testNow.Add(-2 * time.Hour)},
+		{title: "C", due: noDueDate, priority: "3", done: "No", created: testNow.Add(-time.Hour)},
+	}
+	priority := func(title string) string {
+		i := slices.IndexFunc(taskList, func(task Task) bool { return task.title == title })
+		return taskList[i].priority
+	}
+	s := &Session{}
+	captureOutput(t, func() {
+		typeInput("0")
+		s.RunCommand("down")
+		SortBy("priority") // as the main loop does before the next prompt
+		s.RunCommand(".")
+	})
+	if priority("A") != "3" || priority("B") != "1" {
+		t.Errorf(". bumped the wrong task: A %s, B %s", priority("A"), priority("B"))
+	}
+
+	taskList = slices.DeleteFunc(taskList, func(task Task) bool { return task.title == "A" })
+	out := captureOutput(t, func() {
+		typeInput("0")
+		s.RunCommand(".")
+	})
+	if !strings.Contains(out, "Enter task ID to change priority") || taskList[0].priority != "2" {
+		t.Errorf("with the task gone, . should ask again:\n%s", out)
+	}
+}
+
+func TestMergePartialImport(t *testing.T) {
+	setup(t)
+	created := testNow.AddDate(0, -1, 0)
+	list := []Task{{title: "Paint fence", due: testNow.AddDate(0, 0, 2), priority: "1", label: "home", done: "No",
+		notes: "Buy brushes", estimate: 90, color: "cyan", created: created, comments: []string{"# garden"},
+		subtasks: []Subtask{{text: "Sand", done: true}}}}
+
+	path := filepath.Join(t.TempDir(), "in.json")
+	if err := os.WriteFile(path, []byte(`[{"title": "paint fence", "done": "Yes", "priority": "urgent"}]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	imported, _, err := ImportJSON(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged, _ := MergeImported(list, imported, "merge")
+	got := merged[0]
+	if got.done != "Yes" || !got.completed.Equal(testNow) || got.title != "paint fence" {
+		t.Errorf("given fields not applied: %+v", got)
+	}
+	if got.priority != "1" || got.label != "home" || got.notes != "Buy brushes" || got.estimate != 90 || got.color != "cyan" ||
+		!got.due.Equal(list[0].due) || !got.created.Equal(created) || len(got.subtasks) != 1 || len(got.comments) != 1 {
+		t.Errorf("fields the import didn't give (or repaired) were changed: %+v", got)
+	}
+	if !got.modified.Equal(testNow) {
+		t.Errorf("merged task modified = %v", got.modified)
+	}
+
+	csvPath := filepath.Join(t.TempDir(), "in.csv")
+	if err := os.WriteFile(csvPath, []byte("Title,Notes\nPaint fence,\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	imported, err = ImportCSV(csvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged, _ = MergeImported(list, imported, "merge")
+	if got := merged[0]; got.notes != "" || got.priority != "1" || got.label != "home" || got.done != "No" {
+		t.Errorf("CSV merge with only Title and Notes columns gave %+v", got)
+	}
+}
+
+func TestViewCommandsMatchScreen(t *testing.T) {
+	setup(t)
+	t.Setenv("NO_COLOR", "1")
+	taskList = []Task{
+		{title: "Urgent report", due: noDueDate, priority: "1", label: "work", done: "No", estimate: 60},
+		{title: "Slow report", due: noDueDate, priority: "3", label: "work", done: "No", estimate: 30},
+		{title: "Waiting report", due: noDueDate, priority: "1", label: "work", done: "No", estimate: 45, hiddenUntil: "Urgent report"},
+		{title: "Urgent chore", due: noDueDate, priority: "1", label: "home", done: "No", estimate: 15},
+	}
+	query, _ := ParseQuery("priority=1")
+	if ids := ViewIDs(taskList, "work", query, testNow); !slices.Equal(ids, []int{0}) {
+		t.Fatalf("ViewIDs = %v, want [0]", ids)
+	}
+	screen := captureOutput(t, func() { ListTasks("work", query, false, 0) })
+
+	out := captureOutput(t, func() {
+		typeInput("q4", "a", "y", "")
+		BulkLabel("work", query)
+	})
+	if !strings.Contains(out, "Label 1 tasks?") || taskList[0].label != "work,q4" ||
+		taskList[1].label != "work" || taskList[2].label != "work" {
+		t.Errorf("bulk label changed %+v:\n%s", taskList, out)
+	}
+
+	out = captureOutput(t, func() {
+		typeInput("")
+		PrintEstimate("work", query)
+	})
+	if !strings.Contains(out, "Estimated work left: 1h\n") {
+		t.Errorf("estimate for the view:\n%s", out)
+	}
+
+	saved := clipboardCommand
+	t.Cleanup(func() { clipboardCommand = saved })
+	clipboardCommand = func() *exec.Cmd { return nil }
+	out = captureOutput(t, func() {
+		typeInput("")
+		CopyTasks("work", query)
+	})
+	for _, title := range []string{"Slow report", "Waiting report", "Urgent chore"} {
+		if strings.Contains(out, title) || strings.Contains(screen, title) {
+			t.Errorf("%s is out of the view but was listed or copied:\n%s", title, out)
+		}
+	}
+	if !strings.Contains(out, "Urgent report") || !strings.Contains(screen, "Urgent report") {
+		t.Errorf("the task in view wasn't copied:\n%s", out)
+	}
+}